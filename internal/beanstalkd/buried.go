@@ -0,0 +1,144 @@
+package beanstalkd
+
+import (
+	"errors"
+
+	"github.com/beanstalkd/go-beanstalk"
+)
+
+// BuriedJobsQuery is a search for buried jobs. beanstalkd can only
+// peek at the first buried job of a tube, so the most recent MaxScan
+// job IDs (up to the newest job that could be found) are checked one
+// at a time, newest first.
+type BuriedJobsQuery struct {
+	// Tube is the tube of the buried jobs (any tube when empty).
+	Tube string
+	// Limit is the maximum number of buried jobs returned.
+	Limit int
+	// MaxScan is the maximum number of job IDs checked.
+	MaxScan uint64
+	// MaxBodyBytes is the maximum length of each job's body
+	// (the body isn't fetched when zero).
+	MaxBodyBytes int
+}
+
+// BuriedJob is a buried job, with its stats and (possibly truncated) body.
+type BuriedJob struct {
+	ID        uint64
+	Tube      string
+	Stats     JobStats
+	Body      []byte
+	Truncated bool
+}
+
+// FetchBuriedJobs returns the buried jobs matching the query, newest first,
+// and the number of job IDs that were checked. Nothing in beanstalkd is
+// changed by the search.
+func (s *Server) FetchBuriedJobs(query BuriedJobsQuery) ([]BuriedJob, uint64, error) {
+	newest, err := s.newestJobID()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var jobs []BuriedJob
+	var scanned uint64
+	for id := newest; id > 0 && scanned < query.MaxScan && len(jobs) < query.Limit; id-- {
+		scanned++
+		jobStats, err := s.jobStats(id)
+		if err != nil {
+			return nil, scanned, err
+		}
+		if jobStats == nil || jobStats["state"] != "buried" {
+			continue
+		}
+		if query.Tube != "" && jobStats["tube"] != query.Tube {
+			continue
+		}
+		job := BuriedJob{
+			ID:    id,
+			Tube:  jobStats["tube"],
+			Stats: jobStats,
+		}
+		if query.MaxBodyBytes > 0 {
+			body, err := s.jobBody(id)
+			if err != nil {
+				return nil, scanned, err
+			}
+			if body == nil {
+				// The job was deleted in between.
+				continue
+			}
+			if len(body) > query.MaxBodyBytes {
+				body = body[:query.MaxBodyBytes]
+				job.Truncated = true
+			}
+			job.Body = body
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, scanned, nil
+}
+
+// newestJobIDGap is the number of consecutive job IDs that don't exist
+// after which there are assumed to be no newer jobs.
+const newestJobIDGap = 50
+
+// newestJobID returns the ID of the newest job that could be found.
+// beanstalkd can't tell the newest job ID: total-jobs counts the jobs
+// created since beanstalkd started, but the binlog keeps the IDs of
+// older jobs. So the newest job is the newest of the jobs seen before,
+// or any newer job found by checking the job IDs after it (until a gap
+// of newestJobIDGap IDs that don't exist). The jobs at the head of each
+// tube's queues are only peeked at when no job has been seen on the
+// connection yet.
+func (s *Server) newestJobID() (uint64, error) {
+	if s.newestSeenID == 0 {
+		tubes, err := s.ListTubes()
+		if err != nil {
+			return 0, err
+		}
+		for _, tube := range tubes {
+			if _, err := s.PeekTubeHeadJobs(tube); err != nil {
+				return 0, err
+			}
+		}
+	}
+	for id, missing := s.newestSeenID+1, 0; missing < newestJobIDGap; id++ {
+		stats, err := s.jobStats(id)
+		if err != nil {
+			return 0, err
+		}
+		if stats == nil {
+			missing++
+			continue
+		}
+		missing = 0
+		s.sawJob(id)
+	}
+	return s.newestSeenID, nil
+}
+
+// sawJob remembers the job ID when it's the newest seen.
+func (s *Server) sawJob(id uint64) {
+	if id > s.newestSeenID {
+		s.newestSeenID = id
+	}
+}
+
+// jobBody returns the body of a job, or nil when
+// the job doesn't exist.
+func (s *Server) jobBody(id uint64) ([]byte, error) {
+	var body []byte
+	err := s.command("peek", func() error {
+		c, err := s.connect()
+		if err != nil {
+			return err
+		}
+		body, err = c.Peek(id)
+		return err
+	})
+	if errors.Is(err, beanstalk.ErrNotFound) {
+		return nil, nil
+	}
+	return body, err
+}
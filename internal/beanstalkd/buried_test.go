@@ -0,0 +1,174 @@
+package beanstalkd
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func mockBuriedJobsConnection() *mockConnection {
+	return &mockConnection{
+		jobs: map[uint64]map[string]string{
+			1: {"id": "1", "tube": "default", "state": "buried"},
+			2: {"id": "2", "tube": "default", "state": "ready"},
+			3: {"id": "3", "tube": "emails", "state": "buried"},
+			// Job 4 was deleted.
+			5: {"id": "5", "tube": "default", "state": "buried"},
+			// Job 6 is deleted after its stats are fetched.
+			6: {"id": "6", "tube": "default", "state": "buried"},
+		},
+		bodies: map[uint64][]byte{
+			1: []byte("first"),
+			3: []byte("an email"),
+			5: []byte("fifth job body"),
+		},
+	}
+}
+
+func TestFetchBuriedJobs(t *testing.T) {
+	tests := []struct {
+		num             string
+		query           BuriedJobsQuery
+		expectedIDs     []uint64
+		expectedBodies  []string
+		expectedScanned uint64
+	}{
+		// We expect buried jobs in any tube, newest first.
+		{
+			num:             "1) ",
+			query:           BuriedJobsQuery{Limit: 10, MaxScan: 100, MaxBodyBytes: 5},
+			expectedIDs:     []uint64{5, 3, 1},
+			expectedBodies:  []string{"fifth", "an em", "first"},
+			expectedScanned: 6,
+		},
+		// We expect only the buried jobs of the tube.
+		{
+			num:             "2) ",
+			query:           BuriedJobsQuery{Tube: "emails", Limit: 10, MaxScan: 100, MaxBodyBytes: 100},
+			expectedIDs:     []uint64{3},
+			expectedBodies:  []string{"an email"},
+			expectedScanned: 6,
+		},
+		// We expect no bodies when the max body bytes is zero.
+		{
+			num:             "3) ",
+			query:           BuriedJobsQuery{Tube: "default", Limit: 10, MaxScan: 100},
+			expectedIDs:     []uint64{6, 5, 1},
+			expectedBodies:  []string{"", "", ""},
+			expectedScanned: 6,
+		},
+		// We expect the search to stop at the limit.
+		{
+			num:             "4) ",
+			query:           BuriedJobsQuery{Limit: 1, MaxScan: 100, MaxBodyBytes: 100},
+			expectedIDs:     []uint64{5},
+			expectedBodies:  []string{"fifth job body"},
+			expectedScanned: 2,
+		},
+		// We expect the search to stop at the max scan.
+		{
+			num:             "5) ",
+			query:           BuriedJobsQuery{Limit: 10, MaxScan: 3, MaxBodyBytes: 100},
+			expectedIDs:     []uint64{5},
+			expectedBodies:  []string{"fifth job body"},
+			expectedScanned: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		server := &Server{
+			Address:    "localhost:11300",
+			connection: mockBuriedJobsConnection(),
+		}
+		jobs, scanned, err := server.FetchBuriedJobs(tt.query)
+		if err != nil {
+			t.Errorf(tt.num+"expected nil error, actual %v", err)
+		}
+		var actualIDs []uint64
+		var actualBodies []string
+		for _, job := range jobs {
+			actualIDs = append(actualIDs, job.ID)
+			actualBodies = append(actualBodies, string(job.Body))
+		}
+		if !reflect.DeepEqual(tt.expectedIDs, actualIDs) {
+			t.Errorf(tt.num+"expected jobs %v, actual %v", tt.expectedIDs, actualIDs)
+		}
+		if !reflect.DeepEqual(tt.expectedBodies, actualBodies) {
+			t.Errorf(tt.num+"expected bodies %v, actual %v", tt.expectedBodies, actualBodies)
+		}
+		if tt.expectedScanned != scanned {
+			t.Errorf(tt.num+"expected %v scanned, actual %v", tt.expectedScanned, scanned)
+		}
+	}
+}
+
+func TestFetchBuriedJobsAfterRestart(t *testing.T) {
+	// beanstalkd restarted with a binlog, so the job IDs are larger
+	// than the number of jobs created since it started.
+	conn := &mockConnection{
+		stats: map[string]string{"total-jobs": "2"},
+		tubes: []string{"default"},
+		jobs: map[uint64]map[string]string{
+			101: {"id": "101", "tube": "default", "state": "buried"},
+			102: {"id": "102", "tube": "default", "state": "ready"},
+			// Job 103 isn't at the head of a queue.
+			140: {"id": "140", "tube": "default", "state": "buried"},
+		},
+	}
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: conn,
+		tubes: map[string]beanstalkdTube{
+			"default": &mockTube{ready: 102, buried: 101},
+		},
+	}
+
+	// We expect the jobs at the head of the queues, and the newer
+	// jobs after them, to be found. The tubes are only listed and
+	// peeked at the first time.
+	for _, num := range []string{"1) ", "2) "} {
+		jobs, scanned, err := server.FetchBuriedJobs(BuriedJobsQuery{Limit: 10, MaxScan: 100})
+		if err != nil {
+			t.Fatalf(num+"expected nil error, actual %v", err)
+		}
+		var actualIDs []uint64
+		for _, job := range jobs {
+			actualIDs = append(actualIDs, job.ID)
+		}
+		if expected := []uint64{140, 101}; !reflect.DeepEqual(expected, actualIDs) {
+			t.Errorf(num+"expected jobs %v, actual %v", expected, actualIDs)
+		}
+		if expected := uint64(100); expected != scanned {
+			t.Errorf(num+"expected %v scanned, actual %v", expected, scanned)
+		}
+		if expected, actual := 1, conn.listTubesCallCount; expected != actual {
+			t.Errorf(num+"expected %v, actual %v", expected, actual)
+		}
+	}
+}
+
+func TestFetchBuriedJobsTruncated(t *testing.T) {
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: mockBuriedJobsConnection(),
+	}
+	jobs, _, err := server.FetchBuriedJobs(BuriedJobsQuery{Tube: "emails", Limit: 10, MaxScan: 100, MaxBodyBytes: 2})
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if len(jobs) != 1 || !jobs[0].Truncated {
+		t.Errorf("expected a truncated job, actual %v", jobs)
+	}
+}
+
+func TestFetchBuriedJobsError(t *testing.T) {
+	server := &Server{
+		Address: "localhost:11300",
+		connection: &mockConnection{
+			listTubesError: fmt.Errorf("Something went wrong"),
+		},
+	}
+	if _, _, err := server.FetchBuriedJobs(BuriedJobsQuery{Limit: 10, MaxScan: 100}); err == nil {
+		t.Error("expected an error, but got nil")
+	}
+}
@@ -0,0 +1,89 @@
+package beanstalkd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/beanstalkd/go-beanstalk"
+)
+
+// canaryTTR is the time-to-run of canary jobs. It only matters when the
+// exporter stops between reserving and deleting a canary job.
+const canaryTTR = time.Minute
+
+// ErrCanaryTimeout is returned when a canary job isn't
+// reserved before the timeout.
+var ErrCanaryTimeout = errors.New("canary job was not reserved in time")
+
+// ProbeCanary puts a job in the (dedicated) canary tube, reserves it and
+// deletes it, returning how long the round trip took. Any other jobs in
+// the tube, e.g. from an earlier probe that timed out, are deleted too.
+func (s *Server) ProbeCanary(tubeName string, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	body := []byte(fmt.Sprintf("beanstalkd_exporter canary %d", start.UnixNano()))
+
+	var putID uint64
+	err := s.command("put", func() error {
+		tube, err := s.initTube(tubeName)
+		if err != nil {
+			return err
+		}
+		putID, err = tube.Put(body, 0, 0, canaryTTR)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		remaining := timeout - time.Since(start)
+		if remaining < 0 {
+			remaining = 0
+		}
+		var id uint64
+		err := s.command("reserve-with-timeout", func() error {
+			tubeSet, err := s.initTubeSet(tubeName)
+			if err != nil {
+				return err
+			}
+			id, _, err = tubeSet.Reserve(remaining)
+			return err
+		})
+		if errors.Is(err, beanstalk.ErrTimeout) {
+			return 0, ErrCanaryTimeout
+		}
+		if err != nil {
+			return 0, err
+		}
+		err = s.command("delete", func() error {
+			c, err := s.connect()
+			if err != nil {
+				return err
+			}
+			return c.Delete(id)
+		})
+		if err != nil && !errors.Is(err, beanstalk.ErrNotFound) {
+			return 0, err
+		}
+		if id == putID {
+			return time.Since(start), nil
+		}
+	}
+}
+
+func (s *Server) initTubeSet(tubeName string) (beanstalkdTubeSet, error) {
+	c, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	if ts, exists := s.tubeSets[tubeName]; exists {
+		return ts, nil
+	}
+	tubeSet := beanstalk.NewTubeSet(c.(*beanstalk.Conn), tubeName)
+	if s.tubeSets == nil {
+		s.tubeSets = make(map[string]beanstalkdTubeSet)
+	}
+	s.tubeSets[tubeName] = tubeSet
+	return tubeSet, nil
+}
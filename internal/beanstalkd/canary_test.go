@@ -0,0 +1,84 @@
+package beanstalkd
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProbeCanary(t *testing.T) {
+	tests := []struct {
+		num             string
+		reserved        []uint64
+		putError        error
+		expectedError   error
+		expectedDeleted []uint64
+	}{
+		// We expect the canary job to be reserved and deleted.
+		{
+			num:             "1) ",
+			reserved:        []uint64{7},
+			expectedError:   nil,
+			expectedDeleted: []uint64{7},
+		},
+		// We expect older jobs in the tube to be deleted too.
+		{
+			num:             "2) ",
+			reserved:        []uint64{5, 6, 7},
+			expectedError:   nil,
+			expectedDeleted: []uint64{5, 6, 7},
+		},
+		// We expect an error when the canary job isn't reserved.
+		{
+			num:             "3) ",
+			reserved:        nil,
+			expectedError:   ErrCanaryTimeout,
+			expectedDeleted: nil,
+		},
+		{
+			num:             "4) ",
+			reserved:        []uint64{5},
+			expectedError:   ErrCanaryTimeout,
+			expectedDeleted: []uint64{5},
+		},
+	}
+
+	for _, tt := range tests {
+		conn := &mockConnection{}
+		server := &Server{
+			Address:    "localhost:11300",
+			connection: conn,
+			tubes: map[string]beanstalkdTube{
+				"canary": &mockTube{putID: 7},
+			},
+			tubeSets: map[string]beanstalkdTubeSet{
+				"canary": &mockTubeSet{reserved: tt.reserved},
+			},
+		}
+		_, err := server.ProbeCanary("canary", time.Second)
+		if !errors.Is(err, tt.expectedError) {
+			t.Errorf(tt.num+"expected error %v, actual %v", tt.expectedError, err)
+		}
+		if !reflect.DeepEqual(tt.expectedDeleted, conn.deleted) {
+			t.Errorf(tt.num+"expected to delete %v, actual %v", tt.expectedDeleted, conn.deleted)
+		}
+	}
+}
+
+func TestProbeCanaryPutError(t *testing.T) {
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: &mockConnection{},
+		tubes: map[string]beanstalkdTube{
+			"canary": &mockTube{putError: fmt.Errorf("Something went wrong")},
+		},
+	}
+	if _, err := server.ProbeCanary("canary", time.Second); err == nil {
+		t.Error("expected an error, but got nil")
+	}
+	if server.connection != nil {
+		t.Error("expected connection to be nil")
+	}
+}
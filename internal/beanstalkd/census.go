@@ -0,0 +1,135 @@
+package beanstalkd
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CensusJob is a job found by a census.
+type CensusJob struct {
+	ID       uint64
+	Tube     string
+	State    string
+	Age      uint64
+	Reserves uint64
+	TTR      uint64
+	TimeLeft uint64
+}
+
+// CensusResult is the result of the most recent census.
+type CensusResult struct {
+	// Jobs are the jobs that exist in the census window.
+	Jobs []CensusJob
+	// Scanned is the number of job IDs checked, up to NewestID.
+	Scanned  uint64
+	NewestID uint64
+	// FinishedAt is when the census finished (zero before the first
+	// census), and Errors is the number of censuses that failed.
+	FinishedAt time.Time
+	Errors     uint64
+}
+
+// Census walks the stats of the most recent jobs in beanstalkd, in the
+// background. beanstalkd can't list jobs, but job IDs are allocated in
+// order, so the census checks the window of job IDs up to the newest
+// that could be found (which is remembered between censuses).
+// The census should have its own Server, rate limited so that it doesn't
+// get in the way of other clients.
+type Census struct {
+	server   *Server
+	window   uint64
+	interval time.Duration
+
+	mutex  sync.RWMutex
+	result CensusResult
+
+	now func() time.Time
+}
+
+// NewCensus returns a Census of the most recent window of job IDs,
+// repeated every interval.
+func NewCensus(server *Server, window uint64, interval time.Duration) *Census {
+	return &Census{
+		server:   server,
+		window:   window,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Run takes a census every interval, until the context is done.
+func (c *Census) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		_ = c.Take()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Take takes a census. When it fails, the result of the
+// previous census is kept.
+func (c *Census) Take() error {
+	jobs, scanned, newest, err := c.walk()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err != nil {
+		c.result.Errors++
+		return err
+	}
+	c.result.Jobs = jobs
+	c.result.Scanned = scanned
+	c.result.NewestID = newest
+	c.result.FinishedAt = c.now()
+	return nil
+}
+
+// Result returns the result of the most recent census.
+func (c *Census) Result() CensusResult {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.result
+}
+
+func (c *Census) walk() ([]CensusJob, uint64, uint64, error) {
+	newest, err := c.server.newestJobID()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	var jobs []CensusJob
+	var scanned uint64
+	for id := newest; id > 0 && scanned < c.window; id-- {
+		scanned++
+		stats, err := c.server.jobStats(id)
+		if err != nil {
+			return nil, scanned, newest, err
+		}
+		if stats == nil {
+			continue
+		}
+		jobs = append(jobs, CensusJob{
+			ID:       id,
+			Tube:     stats["tube"],
+			State:    stats["state"],
+			Age:      parseJobStat(stats, "age"),
+			Reserves: parseJobStat(stats, "reserves"),
+			TTR:      parseJobStat(stats, "ttr"),
+			TimeLeft: parseJobStat(stats, "time-left"),
+		})
+	}
+	return jobs, scanned, newest, nil
+}
+
+// parseJobStat returns a numeric job stat, or zero
+// when it isn't a number.
+func parseJobStat(stats JobStats, stat string) uint64 {
+	v, _ := strconv.ParseUint(stats[stat], 10, 64)
+	return v
+}
@@ -0,0 +1,120 @@
+package beanstalkd
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCensusTake(t *testing.T) {
+	conn := &mockConnection{
+		jobs: map[uint64]map[string]string{
+			1: {"tube": "default", "state": "ready", "age": "500"},
+			// Job 2 was deleted.
+			3: {"tube": "default", "state": "reserved", "age": "60", "reserves": "2", "ttr": "30", "time-left": "10"},
+			4: {"tube": "emails", "state": "delayed", "age": "5"},
+		},
+	}
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: conn,
+	}
+	now := time.Unix(1700000000, 0)
+	census := NewCensus(server, 3, time.Minute)
+	census.now = func() time.Time { return now }
+
+	// We expect no result before the first census.
+	if !census.Result().FinishedAt.IsZero() {
+		t.Error("expected no census")
+	}
+
+	if err := census.Take(); err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	// We expect only the jobs in the window, newest first.
+	expected := CensusResult{
+		Jobs: []CensusJob{
+			{ID: 4, Tube: "emails", State: "delayed", Age: 5},
+			{ID: 3, Tube: "default", State: "reserved", Age: 60, Reserves: 2, TTR: 30, TimeLeft: 10},
+		},
+		Scanned:    3,
+		NewestID:   4,
+		FinishedAt: now,
+	}
+	if actual := census.Result(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+
+	// We expect the previous result to be kept when a census fails.
+	conn.statsJobError = fmt.Errorf("Something went wrong")
+	server.connection = conn
+	if err := census.Take(); err == nil {
+		t.Error("expected an error, but got nil")
+	}
+	expected.Errors = 1
+	if actual := census.Result(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+}
+
+func TestCensusNewestJob(t *testing.T) {
+	// beanstalkd restarted with a binlog, so the job IDs are larger
+	// than the number of jobs created since it started.
+	conn := &mockConnection{
+		stats: map[string]string{"total-jobs": "1"},
+		tubes: []string{"default"},
+		jobs: map[uint64]map[string]string{
+			500: {"tube": "default", "state": "ready"},
+			// Job 501 was deleted.
+			502: {"tube": "default", "state": "reserved"},
+		},
+	}
+	tube := &mockTube{ready: 500}
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: conn,
+		tubes: map[string]beanstalkdTube{
+			"default": tube,
+		},
+	}
+	census := NewCensus(server, 10, time.Minute)
+
+	tests := []struct {
+		num         string
+		deleted     uint64
+		expectedIDs []uint64
+	}{
+		// We expect the newest job after the head of the queue.
+		{num: "1) ", expectedIDs: []uint64{502, 500}},
+		// We expect the newest job to be remembered after it's deleted.
+		{num: "2) ", deleted: 502, expectedIDs: []uint64{500}},
+	}
+
+	for _, tt := range tests {
+		delete(conn.jobs, tt.deleted)
+		if err := census.Take(); err != nil {
+			t.Fatalf(tt.num+"expected nil error, actual %v", err)
+		}
+		result := census.Result()
+		var actualIDs []uint64
+		for _, job := range result.Jobs {
+			actualIDs = append(actualIDs, job.ID)
+		}
+		if !reflect.DeepEqual(tt.expectedIDs, actualIDs) {
+			t.Errorf(tt.num+"expected jobs %v, actual %v", tt.expectedIDs, actualIDs)
+		}
+		if expected := uint64(502); expected != result.NewestID {
+			t.Errorf(tt.num+"expected newest %v, actual %v", expected, result.NewestID)
+		}
+	}
+
+	// We expect the tubes to be listed, and their queues peeked at,
+	// only by the first census.
+	if expected, actual := 1, conn.listTubesCallCount; expected != actual {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+	if expected, actual := 3, tube.peekCallCount; expected != actual {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+}
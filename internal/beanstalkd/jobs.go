@@ -0,0 +1,158 @@
+package beanstalkd
+
+import (
+	"errors"
+
+	"github.com/beanstalkd/go-beanstalk"
+)
+
+// peekCommand is a command that peeks at the head
+// of one of a tube's queues.
+type peekCommand struct {
+	name string
+	peek func(beanstalkdTube) (uint64, []byte, error)
+}
+
+var (
+	peekReady   = peekCommand{name: "peek-ready", peek: beanstalkdTube.PeekReady}
+	peekDelayed = peekCommand{name: "peek-delayed", peek: beanstalkdTube.PeekDelayed}
+	peekBuried  = peekCommand{name: "peek-buried", peek: beanstalkdTube.PeekBuried}
+)
+
+// FetchTubeHeadJobs returns the stats of the jobs at the head of the
+// tube's ready, delayed and buried queues. Peeking a tube "uses" it,
+// which creates the tube if it doesn't exist, so only existing tubes
+// should be peeked. The connection uses the default tube again after
+// peeking.
+func (s *Server) FetchTubeHeadJobs(tubeName string) (_ TubeHeadJobs, err error) {
+	defer s.useDefaultTube(tubeName, &err)
+	var head TubeHeadJobs
+	head.Ready, err = s.headJob(tubeName, peekReady)
+	if err != nil {
+		return TubeHeadJobs{}, err
+	}
+	head.Delayed, err = s.headJob(tubeName, peekDelayed)
+	if err != nil {
+		return TubeHeadJobs{}, err
+	}
+	head.Buried, err = s.headJob(tubeName, peekBuried)
+	if err != nil {
+		return TubeHeadJobs{}, err
+	}
+	return head, nil
+}
+
+// PeekTubeHeadJobs returns the jobs at the head of the tube's ready,
+// delayed and buried queues, leaving out the queues that are empty.
+// Like FetchTubeHeadJobs, only existing tubes should be peeked.
+func (s *Server) PeekTubeHeadJobs(tubeName string) (_ []Job, err error) {
+	defer s.useDefaultTube(tubeName, &err)
+	var jobs []Job
+	for _, peek := range []peekCommand{peekReady, peekDelayed, peekBuried} {
+		job, err := s.peekJob(tubeName, peek)
+		if err != nil {
+			return nil, err
+		}
+		if job != nil {
+			jobs = append(jobs, *job)
+		}
+	}
+	return jobs, nil
+}
+
+// PeekTubeReadyJob returns the job at the head of the tube's ready
+// queue, with its stats, or nil when the queue is empty. Like
+// FetchTubeHeadJobs, only existing tubes should be peeked.
+func (s *Server) PeekTubeReadyJob(tubeName string) (_ *Job, err error) {
+	defer s.useDefaultTube(tubeName, &err)
+	job, err := s.peekJob(tubeName, peekReady)
+	if job == nil || err != nil {
+		return nil, err
+	}
+	job.Stats, err = s.jobStats(job.ID)
+	if job.Stats == nil || err != nil {
+		// The job may have been reserved in between.
+		return nil, err
+	}
+	return job, nil
+}
+
+// useDefaultTube makes the connection use the default tube again
+// after peeking at a tube. A tube that's used by a connection isn't
+// deleted by beanstalkd when it's empty, and is counted in its
+// current-using stat. There's no command just to use a tube, so the
+// ready queue of the default tube is peeked at, which uses the tube
+// and only reads from it (an empty queue isn't an error). The tube is used
+// again even when peeking failed, unless the connection was reset (a
+// new connection uses the default tube). The error is only set when
+// peeking succeeded.
+func (s *Server) useDefaultTube(tubeName string, err *error) {
+	if tubeName == "default" || s.connection == nil {
+		return
+	}
+	useErr := s.command("use", func() error {
+		tube, err := s.initTube("default")
+		if err != nil {
+			return err
+		}
+		_, _, err = tube.PeekReady()
+		if errors.Is(err, beanstalk.ErrNotFound) {
+			return nil
+		}
+		return err
+	})
+	if *err == nil {
+		*err = useErr
+	}
+}
+
+// headJob peeks at the head of one of the tube's queues, and returns
+// the stats of the job. The stats are nil when the queue is empty (or
+// the job was deleted in between).
+func (s *Server) headJob(tubeName string, peek peekCommand) (JobStats, error) {
+	job, err := s.peekJob(tubeName, peek)
+	if job == nil || err != nil {
+		return nil, err
+	}
+	return s.jobStats(job.ID)
+}
+
+// peekJob peeks at the head of one of the tube's queues. The
+// job is nil when the queue is empty.
+func (s *Server) peekJob(tubeName string, peek peekCommand) (*Job, error) {
+	var job Job
+	err := s.command(peek.name, func() error {
+		tube, err := s.initTube(tubeName)
+		if err != nil {
+			return err
+		}
+		job.ID, job.Body, err = peek.peek(tube)
+		return err
+	})
+	if errors.Is(err, beanstalk.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.sawJob(job.ID)
+	return &job, nil
+}
+
+// jobStats returns the stats of a job, or nil when
+// the job doesn't exist.
+func (s *Server) jobStats(id uint64) (JobStats, error) {
+	var stats map[string]string
+	err := s.command("stats-job", func() error {
+		c, err := s.connect()
+		if err != nil {
+			return err
+		}
+		stats, err = c.StatsJob(id)
+		return err
+	})
+	if errors.Is(err, beanstalk.ErrNotFound) {
+		return nil, nil
+	}
+	return stats, err
+}
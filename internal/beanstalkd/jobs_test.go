@@ -0,0 +1,280 @@
+package beanstalkd
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/beanstalkd/go-beanstalk"
+)
+
+func TestFetchTubeHeadJobs(t *testing.T) {
+	conn := &mockConnection{
+		jobs: map[uint64]map[string]string{
+			1: {"id": "1", "state": "ready", "age": "300"},
+			3: {"id": "3", "state": "buried", "age": "900"},
+		},
+	}
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: conn,
+		tubes: map[string]beanstalkdTube{
+			// The delayed job was deleted after peeking.
+			"default": &mockTube{ready: 1, delayed: 2, buried: 3},
+			"empty":   &mockTube{},
+		},
+	}
+
+	tests := []struct {
+		num      string
+		tube     string
+		expected TubeHeadJobs
+	}{
+		{
+			num:  "1) ",
+			tube: "default",
+			expected: TubeHeadJobs{
+				Ready:  JobStats{"id": "1", "state": "ready", "age": "300"},
+				Buried: JobStats{"id": "3", "state": "buried", "age": "900"},
+			},
+		},
+		{
+			num:      "2) ",
+			tube:     "empty",
+			expected: TubeHeadJobs{},
+		},
+	}
+
+	for _, tt := range tests {
+		actual, err := server.FetchTubeHeadJobs(tt.tube)
+		if err != nil {
+			t.Errorf(tt.num+"expected nil error, actual %v", err)
+		}
+		if !reflect.DeepEqual(tt.expected, actual) {
+			t.Errorf(tt.num+"expected %v, actual %v", tt.expected, actual)
+		}
+	}
+}
+
+func TestPeekTubeHeadJobs(t *testing.T) {
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: &mockConnection{},
+		tubes: map[string]beanstalkdTube{
+			"default": &mockTube{ready: 1, buried: 3},
+			"empty":   &mockTube{},
+		},
+	}
+
+	tests := []struct {
+		num      string
+		tube     string
+		expected []Job
+	}{
+		{
+			num:  "1) ",
+			tube: "default",
+			expected: []Job{
+				{ID: 1, Body: []byte("body")},
+				{ID: 3, Body: []byte("body")},
+			},
+		},
+		{
+			num:      "2) ",
+			tube:     "empty",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		actual, err := server.PeekTubeHeadJobs(tt.tube)
+		if err != nil {
+			t.Errorf(tt.num+"expected nil error, actual %v", err)
+		}
+		if !reflect.DeepEqual(tt.expected, actual) {
+			t.Errorf(tt.num+"expected %v, actual %v", tt.expected, actual)
+		}
+	}
+}
+
+func TestPeekTubeReadyJob(t *testing.T) {
+	server := &Server{
+		Address: "localhost:11300",
+		connection: &mockConnection{
+			jobs: map[uint64]map[string]string{
+				1: {"id": "1", "state": "ready", "age": "300"},
+			},
+		},
+		tubes: map[string]beanstalkdTube{
+			"default":  &mockTube{ready: 1},
+			"reserved": &mockTube{ready: 2},
+			"empty":    &mockTube{},
+		},
+	}
+
+	tests := []struct {
+		num      string
+		tube     string
+		expected *Job
+	}{
+		{
+			num:      "1) ",
+			tube:     "default",
+			expected: &Job{ID: 1, Body: []byte("body"), Stats: JobStats{"id": "1", "state": "ready", "age": "300"}},
+		},
+		// We expect no job when it was reserved after peeking.
+		{
+			num:      "2) ",
+			tube:     "reserved",
+			expected: nil,
+		},
+		{
+			num:      "3) ",
+			tube:     "empty",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		actual, err := server.PeekTubeReadyJob(tt.tube)
+		if err != nil {
+			t.Errorf(tt.num+"expected nil error, actual %v", err)
+		}
+		if !reflect.DeepEqual(tt.expected, actual) {
+			t.Errorf(tt.num+"expected %v, actual %v", tt.expected, actual)
+		}
+	}
+}
+
+func TestPeekUsesDefaultTube(t *testing.T) {
+	defaultTube := &mockTube{}
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: &mockConnection{},
+		tubes: map[string]beanstalkdTube{
+			"default":     defaultTube,
+			"anotherTube": &mockTube{ready: 1},
+		},
+	}
+
+	// We expect the default tube to be used again after peeking at
+	// another tube, but not after peeking at the default tube (which
+	// only peeks at its three queues).
+	tests := []struct {
+		num      string
+		peek     func(tube string) error
+		tube     string
+		expected int
+	}{
+		{
+			num: "1) ",
+			peek: func(tube string) error {
+				_, err := server.FetchTubeHeadJobs(tube)
+				return err
+			},
+			tube:     "anotherTube",
+			expected: 1,
+		},
+		{
+			num: "2) ",
+			peek: func(tube string) error {
+				_, err := server.PeekTubeHeadJobs(tube)
+				return err
+			},
+			tube:     "anotherTube",
+			expected: 2,
+		},
+		{
+			num: "3) ",
+			peek: func(tube string) error {
+				_, err := server.PeekTubeReadyJob(tube)
+				return err
+			},
+			tube:     "anotherTube",
+			expected: 3,
+		},
+		{
+			num: "4) ",
+			peek: func(tube string) error {
+				_, err := server.FetchTubeHeadJobs(tube)
+				return err
+			},
+			tube:     "default",
+			expected: 6,
+		},
+	}
+
+	for _, tt := range tests {
+		if err := tt.peek(tt.tube); err != nil {
+			t.Errorf(tt.num+"expected nil error, actual %v", err)
+		}
+		if tt.expected != defaultTube.peekCallCount {
+			t.Errorf(tt.num+"expected %v, actual %v", tt.expected, defaultTube.peekCallCount)
+		}
+	}
+}
+
+func TestPeekErrorUsesDefaultTube(t *testing.T) {
+	defaultTube := &mockTube{}
+	conn := &mockConnection{}
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: conn,
+		tubes: map[string]beanstalkdTube{
+			"default":     defaultTube,
+			"anotherTube": &mockTube{peekError: beanstalk.ConnError{Op: "peek-ready", Err: beanstalk.ErrOOM}},
+		},
+	}
+
+	// We expect the default tube to be used again after beanstalkd
+	// responds with an error, as the connection is kept.
+	if _, err := server.PeekTubeHeadJobs("anotherTube"); !errors.Is(err, beanstalk.ErrOOM) {
+		t.Errorf("expected %v, actual %v", beanstalk.ErrOOM, err)
+	}
+	if server.connection != conn {
+		t.Error("expected the connection to be kept")
+	}
+	if expected, actual := 1, defaultTube.peekCallCount; expected != actual {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+}
+
+func TestPeekTubeReadyJobErrorUsesDefaultTube(t *testing.T) {
+	defaultTube := &mockTube{}
+	server := &Server{
+		Address: "localhost:11300",
+		connection: &mockConnection{
+			statsJobError: beanstalk.ConnError{Op: "stats-job", Err: beanstalk.ErrInternal},
+		},
+		tubes: map[string]beanstalkdTube{
+			"default":     defaultTube,
+			"anotherTube": &mockTube{ready: 1},
+		},
+	}
+
+	// We expect the default tube to be used again when the stats
+	// of the peeked job can't be fetched.
+	if _, err := server.PeekTubeReadyJob("anotherTube"); !errors.Is(err, beanstalk.ErrInternal) {
+		t.Errorf("expected %v, actual %v", beanstalk.ErrInternal, err)
+	}
+	if expected, actual := 1, defaultTube.peekCallCount; expected != actual {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+}
+
+func TestFetchTubeHeadJobsError(t *testing.T) {
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: &mockConnection{},
+		tubes: map[string]beanstalkdTube{
+			"default": &mockTube{peekError: fmt.Errorf("Something went wrong")},
+		},
+	}
+	if _, err := server.FetchTubeHeadJobs("default"); err == nil {
+		t.Error("expected an error, but got nil")
+	}
+	if server.connection != nil {
+		t.Error("expected connection to be nil")
+	}
+}
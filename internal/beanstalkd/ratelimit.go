@@ -0,0 +1,43 @@
+package beanstalkd
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces out commands, so that no more than
+// a maximum number of commands are sent each second. It
+// can be shared by the servers of several connections.
+type rateLimiter struct {
+	interval time.Duration
+
+	mutex sync.Mutex
+	next  time.Time
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func newRateLimiter(perSecond uint) *rateLimiter {
+	return &rateLimiter{
+		interval: time.Second / time.Duration(perSecond),
+		now:      time.Now,
+		sleep:    time.Sleep,
+	}
+}
+
+// wait blocks until the next command can be sent.
+func (r *rateLimiter) wait() {
+	r.mutex.Lock()
+	now := r.now()
+	at := now
+	if r.next.After(now) {
+		at = r.next
+	}
+	r.next = at.Add(r.interval)
+	r.mutex.Unlock()
+
+	if at.After(now) {
+		r.sleep(at.Sub(now))
+	}
+}
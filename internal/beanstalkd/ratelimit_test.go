@@ -0,0 +1,33 @@
+package beanstalkd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	var slept []time.Duration
+	limiter := newRateLimiter(4)
+	limiter.now = func() time.Time { return now }
+	limiter.sleep = func(d time.Duration) {
+		slept = append(slept, d)
+		now = now.Add(d)
+	}
+
+	// We expect the first command to be sent straight away,
+	// then the next commands to be spaced out.
+	limiter.wait()
+	limiter.wait()
+	limiter.wait()
+
+	// We expect no waiting after a long enough pause.
+	now = now.Add(time.Second)
+	limiter.wait()
+
+	expected := []time.Duration{250 * time.Millisecond, 250 * time.Millisecond}
+	if !reflect.DeepEqual(expected, slept) {
+		t.Errorf("expected to sleep %v, actual %v", expected, slept)
+	}
+}
@@ -0,0 +1,183 @@
+package beanstalkd
+
+import (
+	"errors"
+	"time"
+
+	"github.com/beanstalkd/go-beanstalk"
+)
+
+const (
+	defaultRetries          = 1
+	defaultRetryBaseDelay   = 100 * time.Millisecond
+	defaultRetryMaxDelay    = 2 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned instead of sending commands to
+// beanstalkd while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// serverErrors are the errors beanstalkd responds with. These
+// errors don't mean there's a problem with the connection.
+var serverErrors = []error{
+	beanstalk.ErrBadFormat,
+	beanstalk.ErrBuried,
+	beanstalk.ErrDeadline,
+	beanstalk.ErrDraining,
+	beanstalk.ErrInternal,
+	beanstalk.ErrJobTooBig,
+	beanstalk.ErrNoCRLF,
+	beanstalk.ErrNotFound,
+	beanstalk.ErrNotIgnored,
+	beanstalk.ErrOOM,
+	beanstalk.ErrTimeout,
+	beanstalk.ErrUnknown,
+}
+
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, e := range serverErrors {
+		if errors.Is(err, e) {
+			return false
+		}
+	}
+	return true
+}
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets commands through to beanstalkd.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen stops commands being sent to beanstalkd.
+	BreakerOpen
+	// BreakerHalfOpen lets a command through to beanstalkd, to
+	// find out whether beanstalkd is healthy again.
+	BreakerHalfOpen
+)
+
+// ConnectionStats are the stats about the connection to beanstalkd.
+type ConnectionStats struct {
+	Retries      uint64
+	BreakerState BreakerState
+	BreakerTrips uint64
+
+	// Addresses are the addresses of beanstalkd, and ActiveAddress is
+	// the address that most recently answered (if any).
+	Addresses     []string
+	ActiveAddress string
+}
+
+// circuitBreaker stops commands being sent to beanstalkd after too
+// many consecutive connection problems, until a cooldown has passed.
+type circuitBreaker struct {
+	threshold uint
+	cooldown  time.Duration
+
+	state    BreakerState
+	failures uint
+	openedAt time.Time
+	trips    uint64
+
+	now func() time.Time
+}
+
+func newCircuitBreaker(threshold uint, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow returns an error when commands shouldn't be sent to beanstalkd.
+func (b *circuitBreaker) allow() error {
+	if b == nil || b.state != BreakerOpen {
+		return nil
+	}
+	if b.now().Sub(b.openedAt) < b.cooldown {
+		return ErrCircuitOpen
+	}
+	b.state = BreakerHalfOpen
+	return nil
+}
+
+// record records whether a command had a connection problem.
+func (b *circuitBreaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+	if !failed {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+		b.failures = 0
+		b.trips++
+	}
+}
+
+// SetRetries sets the number of times a command is retried after a
+// connection problem. Before each retry, the connection is re-established
+// after an exponential backoff (with jitter).
+func (s *Server) SetRetries(retries uint) {
+	s.retries = retries
+}
+
+// SetRetryDelays sets the exponential backoff before each retry, starting
+// at baseDelay and never more than maxDelay (100ms and 2s by default).
+func (s *Server) SetRetryDelays(baseDelay time.Duration, maxDelay time.Duration) {
+	s.retryBaseDelay = baseDelay
+	s.retryMaxDelay = maxDelay
+}
+
+// SetCircuitBreaker stops commands being sent to beanstalkd for the
+// cooldown, after threshold consecutive commands with connection problems.
+// There is no circuit breaker when threshold is zero.
+func (s *Server) SetCircuitBreaker(threshold uint, cooldown time.Duration) {
+	if threshold == 0 {
+		s.breaker = nil
+		return
+	}
+	s.breaker = newCircuitBreaker(threshold, cooldown)
+}
+
+// ConnectionStats returns the stats about the connection to beanstalkd.
+func (s *Server) ConnectionStats() ConnectionStats {
+	stats := ConnectionStats{
+		Retries:       s.retryCount,
+		Addresses:     s.addresses,
+		ActiveAddress: s.activeAddress,
+	}
+	if len(stats.Addresses) == 0 {
+		stats.Addresses = []string{s.Address}
+	}
+	if s.breaker != nil {
+		stats.BreakerState = s.breaker.state
+		stats.BreakerTrips = s.breaker.trips
+	}
+	return stats
+}
+
+// backoff returns how long to wait before the given retry (starting at
+// zero), doubling each time, and with "full jitter" so that exporters
+// don't all reconnect at the same moment.
+func (s *Server) backoff(retry uint) time.Duration {
+	delay := s.retryMaxDelay
+	if retry < 32 && s.retryBaseDelay<<retry < s.retryMaxDelay {
+		delay = s.retryBaseDelay << retry
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(s.random(int64(delay)))
+}
@@ -0,0 +1,177 @@
+package beanstalkd
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/beanstalkd/go-beanstalk"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{err: nil, expected: false},
+		{err: fmt.Errorf("connection reset by peer"), expected: true},
+		{err: beanstalk.ConnError{Op: "stats", Err: fmt.Errorf("EOF")}, expected: true},
+		{err: beanstalk.ConnError{Op: "stats-tube", Err: beanstalk.ErrNotFound}, expected: false},
+		{err: beanstalk.ConnError{Op: "stats", Err: beanstalk.ErrInternal}, expected: false},
+	}
+
+	for _, tt := range tests {
+		if actual := isConnectionError(tt.err); tt.expected != actual {
+			t.Errorf("expected %v for error %v, actual %v", tt.expected, tt.err, actual)
+		}
+	}
+}
+
+func TestCommandRetries(t *testing.T) {
+	var slept []time.Duration
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: &mockConnection{},
+		dialer: &mockDialer{
+			conn: &mockNetConn{},
+		},
+	}
+	server.SetRetries(2)
+	server.SetRetryDelays(100*time.Millisecond, 150*time.Millisecond)
+	server.sleep = func(d time.Duration) {
+		slept = append(slept, d)
+	}
+	server.random = func(n int64) int64 {
+		return n
+	}
+
+	tests := []struct {
+		num             string
+		errs            []error
+		expectedCalls   int
+		expectedError   bool
+		expectedRetries uint64
+	}{
+		// We expect a command that works not to be retried.
+		{num: "1) ", errs: []error{nil}, expectedCalls: 1, expectedError: false, expectedRetries: 0},
+		// We expect errors from beanstalkd not to be retried.
+		{num: "2) ", errs: []error{beanstalk.ErrNotFound}, expectedCalls: 1, expectedError: true, expectedRetries: 0},
+		// We expect a connection problem to be retried.
+		{num: "3) ", errs: []error{fmt.Errorf("EOF"), nil}, expectedCalls: 2, expectedError: false, expectedRetries: 1},
+		// We expect no more than the configured retries.
+		{num: "4) ", errs: []error{fmt.Errorf("EOF"), fmt.Errorf("EOF"), fmt.Errorf("EOF")}, expectedCalls: 3, expectedError: true, expectedRetries: 3},
+	}
+
+	for _, tt := range tests {
+		calls := 0
+		err := server.command("stats", func() error {
+			err := tt.errs[calls]
+			calls++
+			return err
+		})
+		if tt.expectedCalls != calls {
+			t.Errorf(tt.num+"expected %v calls, actual %v", tt.expectedCalls, calls)
+		}
+		if tt.expectedError != (err != nil) {
+			t.Errorf(tt.num+"expected error %v, actual %v", tt.expectedError, err)
+		}
+		if actual := server.ConnectionStats().Retries; tt.expectedRetries != actual {
+			t.Errorf(tt.num+"expected %v retries, actual %v", tt.expectedRetries, actual)
+		}
+	}
+
+	// We expect the backoff to double, up to the max delay.
+	expected := []time.Duration{100 * time.Millisecond, 100 * time.Millisecond, 150 * time.Millisecond}
+	if !reflect.DeepEqual(expected, slept) {
+		t.Errorf("expected to sleep %v, actual %v", expected, slept)
+	}
+	// We expect the connection to be reset after connection problems.
+	if server.connection != nil {
+		t.Error("expected connection to be nil")
+	}
+}
+
+func TestSetRetriesKeepsDefaultDelays(t *testing.T) {
+	server, err := NewServer("localhost:11300", 1, 1)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	server.SetRetries(3)
+	if expected, actual := uint(3), server.retries; expected != actual {
+		t.Errorf("expected %v retries, actual %v", expected, actual)
+	}
+	if expected, actual := defaultRetryBaseDelay, server.retryBaseDelay; expected != actual {
+		t.Errorf("expected base delay %v, actual %v", expected, actual)
+	}
+	if expected, actual := defaultRetryMaxDelay, server.retryMaxDelay; expected != actual {
+		t.Errorf("expected max delay %v, actual %v", expected, actual)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: &mockConnection{},
+		dialer: &mockDialer{
+			conn: &mockNetConn{},
+		},
+	}
+	server.SetCircuitBreaker(2, 30*time.Second)
+	server.breaker.now = func() time.Time { return now }
+
+	calls := 0
+	failing := func() error {
+		calls++
+		return fmt.Errorf("EOF")
+	}
+	working := func() error {
+		calls++
+		return nil
+	}
+
+	tests := []struct {
+		num           string
+		elapsed       time.Duration
+		fn            func() error
+		expectedCalls int
+		expectedError error
+		expectedState BreakerState
+		expectedTrips uint64
+	}{
+		// We expect the breaker to open after consecutive connection problems.
+		{num: "1) ", fn: failing, expectedCalls: 1, expectedState: BreakerClosed, expectedTrips: 0},
+		{num: "2) ", fn: failing, expectedCalls: 2, expectedState: BreakerOpen, expectedTrips: 1},
+		// We expect commands to fail fast while the breaker is open.
+		{num: "3) ", elapsed: 10 * time.Second, fn: working, expectedCalls: 2, expectedError: ErrCircuitOpen, expectedState: BreakerOpen, expectedTrips: 1},
+		// We expect a failing command after the cooldown to open the breaker again.
+		{num: "4) ", elapsed: 20 * time.Second, fn: failing, expectedCalls: 3, expectedState: BreakerOpen, expectedTrips: 2},
+		// We expect a working command after the cooldown to close the breaker.
+		{num: "5) ", elapsed: 30 * time.Second, fn: working, expectedCalls: 4, expectedState: BreakerClosed, expectedTrips: 2},
+	}
+
+	for _, tt := range tests {
+		now = now.Add(tt.elapsed)
+		err := server.command("stats", tt.fn)
+		if tt.expectedCalls != calls {
+			t.Errorf(tt.num+"expected %v calls, actual %v", tt.expectedCalls, calls)
+		}
+		if tt.expectedError != nil && tt.expectedError != err {
+			t.Errorf(tt.num+"expected error %v, actual %v", tt.expectedError, err)
+		}
+		stats := server.ConnectionStats()
+		if tt.expectedState != stats.BreakerState {
+			t.Errorf(tt.num+"expected breaker state %v, actual %v", tt.expectedState, stats.BreakerState)
+		}
+		if tt.expectedTrips != stats.BreakerTrips {
+			t.Errorf(tt.num+"expected %v breaker trips, actual %v", tt.expectedTrips, stats.BreakerTrips)
+		}
+	}
+
+	// We expect no circuit breaker without a threshold.
+	server.SetCircuitBreaker(0, time.Second)
+	if server.breaker != nil {
+		t.Error("expected no circuit breaker")
+	}
+}
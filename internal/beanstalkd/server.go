@@ -1,8 +1,11 @@
 package beanstalkd
 
 import (
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"net"
+	"sort"
 	"time"
 
 	"github.com/beanstalkd/go-beanstalk"
@@ -11,10 +14,21 @@ import (
 type beanstalkdConnection interface {
 	Stats() (map[string]string, error)
 	ListTubes() ([]string, error)
+	StatsJob(id uint64) (map[string]string, error)
+	Peek(id uint64) ([]byte, error)
+	Delete(id uint64) error
 }
 
 type beanstalkdTube interface {
 	Stats() (map[string]string, error)
+	PeekReady() (id uint64, body []byte, err error)
+	PeekDelayed() (id uint64, body []byte, err error)
+	PeekBuried() (id uint64, body []byte, err error)
+	Put(body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error)
+}
+
+type beanstalkdTubeSet interface {
+	Reserve(timeout time.Duration) (id uint64, body []byte, err error)
 }
 
 type beanstalkdDialer interface {
@@ -26,11 +40,37 @@ type Server struct {
 	// Address is the address of the beanstalkd instance.
 	Address string
 
+	// addresses are the addresses to try, in order, when connecting
+	// (e.g. an active/standby pair), and activeAddress is the address
+	// that most recently answered.
+	addresses     []string
+	activeAddress string
+
 	connection beanstalkdConnection
 	dialer     beanstalkdDialer
 	tubes      map[string]beanstalkdTube
+	tubeSets   map[string]beanstalkdTubeSet
+	limiter    *rateLimiter
+
+	// newestSeenID is the ID of the newest job seen
+	// since connecting.
+	newestSeenID uint64
+
+	retries        uint
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+	retryCount     uint64
+	breaker        *circuitBreaker
+
+	observer CommandObserver
+
+	sleep  func(time.Duration)
+	random func(int64) int64
 }
 
+// CommandObserver observes how long a command sent to beanstalkd took.
+type CommandObserver func(command string, duration time.Duration)
+
 // NewServer returns an initialised Server
 func NewServer(address string, dialTimeout uint, keepAlivePeriod uint) (*Server, error) {
 	if dialTimeout < 1 || dialTimeout > 30 {
@@ -47,57 +87,103 @@ func NewServer(address string, dialTimeout uint, keepAlivePeriod uint) (*Server,
 			Timeout:   time.Duration(dialTimeout) * time.Second,
 			KeepAlive: time.Duration(keepAlivePeriod) * time.Second,
 		},
-		tubes: nil,
+		tubes:          nil,
+		retries:        defaultRetries,
+		retryBaseDelay: defaultRetryBaseDelay,
+		retryMaxDelay:  defaultRetryMaxDelay,
+		breaker:        newCircuitBreaker(defaultBreakerThreshold, defaultBreakerCooldown),
+		sleep:          time.Sleep,
+		random:         rand.Int64N,
 	}, nil
 }
 
+// SetAddresses sets the addresses of beanstalkd to try, in order,
+// when connecting. The first address becomes the server's Address.
+func (s *Server) SetAddresses(addresses []string) {
+	if len(addresses) == 0 {
+		return
+	}
+	s.Address = addresses[0]
+	s.addresses = addresses
+}
+
+// SetCommandObserver sets the observer of each command sent to beanstalkd.
+func (s *Server) SetCommandObserver(observer CommandObserver) {
+	s.observer = observer
+}
+
+// SetMaxCommandsPerSecond limits the number of commands sent to
+// beanstalkd each second. There is no limit when n is zero.
+func (s *Server) SetMaxCommandsPerSecond(n uint) {
+	if n == 0 {
+		s.limiter = nil
+		return
+	}
+	s.limiter = newRateLimiter(n)
+}
+
+// ShareMaxCommandsPerSecond makes the server share the limit of the
+// other server on the commands sent to beanstalkd each second, so the
+// commands on both connections count towards the same limit.
+func (s *Server) ShareMaxCommandsPerSecond(other *Server) {
+	s.limiter = other.limiter
+}
+
 // ListTubes returns the list of tubes from beanstalkd.
 func (s *Server) ListTubes() ([]string, error) {
-	c, err := s.connect()
-	if err != nil {
-		return nil, err
-	}
-	tubes, err := c.ListTubes()
+	var tubes []string
+	err := s.command("list-tubes", func() error {
+		c, err := s.connect()
+		if err != nil {
+			return err
+		}
+		tubes, err = c.ListTubes()
+		return err
+	})
 	return tubes, err
 }
 
 // FetchStats returns the server stats from beanstalkd.
 func (s *Server) FetchStats() (ServerStats, error) {
-	c, err := s.connect()
-	if err != nil {
-		return nil, err
-	}
-	stats, err := c.Stats()
-	if err != nil {
-		// Fetching stats failed, so maybe there's a connection problem.
-		s.connection = nil
-		s.tubes = make(map[string]beanstalkdTube)
-	}
+	var stats map[string]string
+	err := s.command("stats", func() error {
+		c, err := s.connect()
+		if err != nil {
+			return err
+		}
+		stats, err = c.Stats()
+		return err
+	})
 	return stats, err
 }
 
 // FetchTubesStats returns the tube stats from beanstalkd.
-// The result is a map of stats per tube.
+// The result is a map of stats per tube. Tubes that don't
+// exist in beanstalkd are not included in the result.
 func (s *Server) FetchTubesStats(tubes map[string]bool) (ManyTubeStats, error) {
-	c, err := s.connect()
-	if err != nil {
-		return nil, err
-	}
-	allTubes, err := c.ListTubes()
+	err := s.command("", func() error {
+		_, err := s.connect()
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	if len(allTubes) == 0 {
-		return nil, nil
+	// Fetch the tubes in a predictable order.
+	tubeNames := make([]string, 0, len(tubes))
+	for tube := range tubes {
+		tubeNames = append(tubeNames, tube)
 	}
+	sort.Strings(tubeNames)
+
 	tubesStats := make(ManyTubeStats)
-	for _, tube := range allTubes {
-		if _, ok := tubes[tube]; ok {
-			tStats, err := s.tubeStats(tube)
-			tubesStats[tube] = TubeStatsOrError{
-				Stats: tStats,
-				Err:   err,
-			}
+	for _, tube := range tubeNames {
+		tStats, err := s.tubeStats(tube)
+		if errors.Is(err, beanstalk.ErrNotFound) {
+			continue
+		}
+		tubesStats[tube] = TubeStatsOrError{
+			Stats: tStats,
+			Err:   err,
 		}
 	}
 	if len(tubesStats) == 0 {
@@ -107,19 +193,71 @@ func (s *Server) FetchTubesStats(tubes map[string]bool) (ManyTubeStats, error) {
 }
 
 func (s *Server) tubeStats(tubeName string) (TubeStats, error) {
-	tube, err := s.initTube(tubeName)
-	if err != nil {
-		return nil, err
-	}
-	stats, err := tube.Stats()
-	if err != nil {
-		// Fetching stats failed, so maybe there's a connection problem.
-		s.connection = nil
-		s.tubes = make(map[string]beanstalkdTube)
+	var stats map[string]string
+	err := s.command("stats-tube", func() error {
+		tube, err := s.initTube(tubeName)
+		if err != nil {
+			return err
+		}
+		stats, err = tube.Stats()
+		return err
+	})
+	if errors.Is(err, beanstalk.ErrNotFound) {
+		// The tube doesn't exist, so forget about it.
+		delete(s.tubes, tubeName)
 	}
 	return stats, err
 }
 
+// command sends the named command to beanstalkd, once the rate limit
+// allows. When there's a connection problem, the connection is reset and
+// the command is retried (if configured), unless the circuit breaker is
+// open. The duration of each attempt is observed, unless the name is
+// empty (e.g. when only connecting). Connecting isn't part of the
+// observed duration.
+func (s *Server) command(name string, fn func() error) error {
+	if err := s.breaker.allow(); err != nil {
+		return err
+	}
+	err := s.attempt(name, fn)
+	for retry := uint(0); isConnectionError(err) && retry < s.retries; retry++ {
+		s.resetConnection()
+		s.retryCount++
+		s.sleep(s.backoff(retry))
+		err = s.attempt(name, fn)
+	}
+	if isConnectionError(err) {
+		s.resetConnection()
+	}
+	s.breaker.record(isConnectionError(err))
+	return err
+}
+
+func (s *Server) attempt(name string, fn func() error) error {
+	if s.limiter != nil {
+		s.limiter.wait()
+	}
+	if _, err := s.connect(); err != nil {
+		return err
+	}
+	if s.observer == nil || name == "" {
+		return fn()
+	}
+	start := time.Now()
+	err := fn()
+	s.observer(name, time.Since(start))
+	return err
+}
+
+// resetConnection forgets the connection, and what was seen on it
+// (beanstalkd may have restarted, or another address may answer).
+func (s *Server) resetConnection() {
+	s.connection = nil
+	s.newestSeenID = 0
+	s.tubes = make(map[string]beanstalkdTube)
+	s.tubeSets = nil
+}
+
 func (s *Server) connect() (beanstalkdConnection, error) {
 	if s.connection != nil {
 		return s.connection, nil
@@ -130,11 +268,20 @@ func (s *Server) connect() (beanstalkdConnection, error) {
 }
 
 func (s *Server) dial() (beanstalkdConnection, error) {
-	c, err := s.dialer.Dial("tcp", s.Address)
-	if err != nil {
-		return nil, err
+	addresses := s.addresses
+	if len(addresses) == 0 {
+		addresses = []string{s.Address}
+	}
+	var err error
+	for _, address := range addresses {
+		var c net.Conn
+		c, err = s.dialer.Dial("tcp", address)
+		if err == nil {
+			s.activeAddress = address
+			return beanstalk.NewConn(c), nil
+		}
 	}
-	return beanstalk.NewConn(c), nil
+	return nil, err
 }
 
 func (s *Server) initTube(tubeName string) (beanstalkdTube, error) {
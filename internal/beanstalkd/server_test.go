@@ -7,6 +7,8 @@ import (
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/beanstalkd/go-beanstalk"
 )
 
 func TestNewServer(t *testing.T) {
@@ -152,10 +154,8 @@ func TestFetchTubesStats(t *testing.T) {
 		tubes:              []string{"default", "anotherTube", "errorTube"},
 		listTubesCallCount: 0,
 	}
-	server := &Server{
-		Address:    "localhost:11300",
-		connection: conn,
-		tubes: map[string]beanstalkdTube{
+	mockTubes := func() map[string]beanstalkdTube {
+		return map[string]beanstalkdTube{
 			"default": &mockTube{
 				stats: map[string]string{
 					"current-jobs-urgent": "10",
@@ -171,46 +171,36 @@ func TestFetchTubesStats(t *testing.T) {
 			"errorTube": &mockTube{
 				statsError: fmt.Errorf("Oops"),
 			},
-		},
+			"deletedTube": &mockTube{
+				statsError: beanstalk.ConnError{Op: "stats-tube", Err: beanstalk.ErrNotFound},
+			},
+		}
+	}
+	server := &Server{
+		Address: "localhost:11300",
 	}
 
 	tests := []struct {
-		num                        string
-		tubes                      map[string]bool
-		listTubesError             error
-		expectedListTubesCallCount int
-		expectedTubesStats         ManyTubeStats
+		num                string
+		tubes              map[string]bool
+		expectedTubesStats ManyTubeStats
 	}{
 		// We expect empty tubes stats when we don't specify the tube names.
 		{
-			num:                        "1) ",
-			tubes:                      nil,
-			listTubesError:             nil,
-			expectedListTubesCallCount: 1,
-			expectedTubesStats:         nil,
+			num:                "1) ",
+			tubes:              nil,
+			expectedTubesStats: nil,
 		},
 		// We expect empty tubes stats when the tubes don't exist.
 		{
-			num:                        "2) ",
-			tubes:                      map[string]bool{"doesNotExist": true},
-			listTubesError:             nil,
-			expectedListTubesCallCount: 1,
-			expectedTubesStats:         nil,
-		},
-		// We expect empty tubes stats when there are errors.
-		{
-			num:                        "3) ",
-			tubes:                      map[string]bool{"default": true},
-			listTubesError:             fmt.Errorf("Something went wrong"),
-			expectedListTubesCallCount: 1,
-			expectedTubesStats:         nil,
+			num:                "2) ",
+			tubes:              map[string]bool{"deletedTube": true},
+			expectedTubesStats: nil,
 		},
 		// We expect the stats for the tubes we ask for.
 		{
-			num:                        "4) ",
-			tubes:                      map[string]bool{"anotherTube": true},
-			listTubesError:             nil,
-			expectedListTubesCallCount: 1,
+			num:   "3) ",
+			tubes: map[string]bool{"anotherTube": true, "deletedTube": true},
 			expectedTubesStats: ManyTubeStats{
 				"anotherTube": TubeStatsOrError{
 					Stats: map[string]string{
@@ -224,10 +214,8 @@ func TestFetchTubesStats(t *testing.T) {
 		// We expect the stats for the tubes we ask for, even
 		// if there are errors for only some tubes.
 		{
-			num:                        "5) ",
-			tubes:                      map[string]bool{"default": true, "errorTube": true},
-			listTubesError:             nil,
-			expectedListTubesCallCount: 1,
+			num:   "4) ",
+			tubes: map[string]bool{"default": true, "errorTube": true},
 			expectedTubesStats: ManyTubeStats{
 				"default": TubeStatsOrError{
 					Stats: map[string]string{
@@ -246,17 +234,15 @@ func TestFetchTubesStats(t *testing.T) {
 
 	for _, tt := range tests {
 		conn.listTubesCallCount = 0
-		conn.listTubesError = tt.listTubesError
+		server.connection = conn
+		server.tubes = mockTubes()
 		actualTubesStats, err := server.FetchTubesStats(tt.tubes)
-		if tt.listTubesError == nil && err != nil {
+		if err != nil {
 			t.Error(err)
 		}
-		if tt.expectedListTubesCallCount != conn.listTubesCallCount {
-			t.Errorf(
-				tt.num+"expected ListTubes() to be called %v times, actual %v",
-				tt.expectedListTubesCallCount,
-				conn.listTubesCallCount,
-			)
+		// We expect the tubes to never be listed.
+		if conn.listTubesCallCount != 0 {
+			t.Errorf(tt.num+"expected ListTubes() to not be called, actual %v", conn.listTubesCallCount)
 		}
 		if !reflect.DeepEqual(tt.expectedTubesStats, actualTubesStats) {
 			t.Errorf(
@@ -265,15 +251,46 @@ func TestFetchTubesStats(t *testing.T) {
 				actualTubesStats,
 			)
 		}
-		if tt.listTubesError != nil {
-			if err == nil {
-				t.Error("expected tubes stats error, but got nil")
-			}
-			expectedError := "Something went wrong"
-			if err.Error() != expectedError {
-				t.Errorf("expected error %v, actual %v", expectedError, err.Error())
-			}
-		}
+	}
+}
+
+func TestFetchTubesStatsNotFoundKeepsConnection(t *testing.T) {
+	conn := &mockConnection{}
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: conn,
+		tubes: map[string]beanstalkdTube{
+			"deletedTube": &mockTube{
+				statsError: beanstalk.ConnError{Op: "stats-tube", Err: beanstalk.ErrNotFound},
+			},
+		},
+	}
+	_, err := server.FetchTubesStats(map[string]bool{"deletedTube": true})
+	if err != nil {
+		t.Errorf("expected nil error, actual %v", err)
+	}
+	if server.connection == nil {
+		t.Error("expected the connection to be kept")
+	}
+	if _, ok := server.tubes["deletedTube"]; ok {
+		t.Error("expected the deleted tube to be forgotten")
+	}
+}
+
+func TestListTubesError(t *testing.T) {
+	conn := &mockConnection{
+		listTubesError: fmt.Errorf("Something went wrong"),
+	}
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: conn,
+	}
+	_, err := server.ListTubes()
+	if err == nil {
+		t.Error("expected an error, but got nil")
+	}
+	if server.connection != nil {
+		t.Error("expected connection to be nil")
 	}
 }
 
@@ -292,7 +309,7 @@ func TestFetchTubesStatsConnectError(t *testing.T) {
 	}
 }
 
-func TestFetchTubesStatsWithNoListedTubes(t *testing.T) {
+func TestFetchTubesStatsWithNoTubes(t *testing.T) {
 	conn := &mockConnection{
 		tubes:              []string{},
 		listTubesCallCount: 0,
@@ -301,7 +318,7 @@ func TestFetchTubesStatsWithNoListedTubes(t *testing.T) {
 		Address:    "localhost:11300",
 		connection: conn,
 	}
-	actualTubesStats, err := server.FetchTubesStats(map[string]bool{"default": true})
+	actualTubesStats, err := server.FetchTubesStats(map[string]bool{})
 	if actualTubesStats != nil {
 		t.Errorf("expected nil tubes stats, actual %v", actualTubesStats)
 	}
@@ -310,6 +327,95 @@ func TestFetchTubesStatsWithNoListedTubes(t *testing.T) {
 	}
 }
 
+func TestSetMaxCommandsPerSecond(t *testing.T) {
+	conn := &mockConnection{
+		tubes: []string{"default"},
+	}
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: conn,
+	}
+
+	// We expect commands to wait for the rate limiter.
+	server.SetMaxCommandsPerSecond(10)
+	slept := 0
+	server.limiter.sleep = func(d time.Duration) {
+		slept++
+	}
+	_, _ = server.ListTubes()
+	_, _ = server.FetchStats()
+	if expected, actual := 1, slept; expected != actual {
+		t.Errorf("expected to wait %v times, actual %v", expected, actual)
+	}
+
+	// We expect the commands of a server sharing the limit to
+	// wait for the same rate limiter.
+	other := &Server{
+		Address:    "localhost:11300",
+		connection: conn,
+	}
+	other.ShareMaxCommandsPerSecond(server)
+	_, _ = other.ListTubes()
+	if expected, actual := 2, slept; expected != actual {
+		t.Errorf("expected to wait %v times, actual %v", expected, actual)
+	}
+
+	// We expect no rate limiter without a limit.
+	server.SetMaxCommandsPerSecond(0)
+	if server.limiter != nil {
+		t.Error("expected no rate limiter")
+	}
+}
+
+func TestSetCommandObserver(t *testing.T) {
+	conn := &mockConnection{
+		tubes: []string{"default"},
+	}
+	server := &Server{
+		Address:    "localhost:11300",
+		connection: conn,
+		tubes: map[string]beanstalkdTube{
+			"default": &mockTube{},
+		},
+	}
+
+	// We expect each command to be observed, but not connecting.
+	var observed []string
+	server.SetCommandObserver(func(command string, duration time.Duration) {
+		observed = append(observed, command)
+	})
+	_, _ = server.ListTubes()
+	_, _ = server.FetchStats()
+	_, _ = server.FetchTubesStats(map[string]bool{"default": true})
+	_, _ = server.FetchTubeHeadJobs("default")
+	expected := []string{"list-tubes", "stats", "stats-tube", "peek-ready", "peek-delayed", "peek-buried"}
+	if !reflect.DeepEqual(expected, observed) {
+		t.Errorf("expected to observe %v, actual %v", expected, observed)
+	}
+}
+
+func TestSetCommandObserverSlowConnect(t *testing.T) {
+	server := &Server{
+		Address: "localhost:11300",
+		dialer: &mockDialer{
+			conn:  &mockNetConn{},
+			delay: 100 * time.Millisecond,
+		},
+		tubes: make(map[string]beanstalkdTube),
+	}
+
+	// We expect the time taken to connect not to be observed
+	// as part of the command.
+	var observed time.Duration
+	server.SetCommandObserver(func(command string, duration time.Duration) {
+		observed = duration
+	})
+	_, _ = server.ListTubes()
+	if observed >= 100*time.Millisecond {
+		t.Errorf("expected to observe less than 100ms, actual %v", observed)
+	}
+}
+
 func TestConnect(t *testing.T) {
 	server := &Server{
 		Address: "localhost:11300",
@@ -326,6 +432,45 @@ func TestConnect(t *testing.T) {
 	}
 }
 
+func TestConnectFailover(t *testing.T) {
+	dialer := &mockFailoverDialer{
+		conns: map[string]net.Conn{
+			"standby:11300": &mockNetConn{},
+		},
+	}
+	server := &Server{
+		Address: "localhost:11300",
+		dialer:  dialer,
+	}
+	server.SetAddresses([]string{"active:11300", "standby:11300"})
+	if expected, actual := "active:11300", server.Address; expected != actual {
+		t.Errorf("expected address %v, actual %v", expected, actual)
+	}
+
+	// We expect the addresses to be tried in order.
+	if _, err := server.connect(); err != nil {
+		t.Errorf("expecting no error, actual %v", err)
+	}
+	if expected, actual := []string{"active:11300", "standby:11300"}, dialer.dialed; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected to dial %v, actual %v", expected, actual)
+	}
+	stats := server.ConnectionStats()
+	if expected, actual := "standby:11300", stats.ActiveAddress; expected != actual {
+		t.Errorf("expected active address %v, actual %v", expected, actual)
+	}
+
+	// We expect an error when no address answers, but the
+	// active address to be remembered.
+	server.resetConnection()
+	dialer.conns = nil
+	if _, err := server.connect(); err == nil {
+		t.Error("expected a connection error, but got nil")
+	}
+	if expected, actual := "standby:11300", server.ConnectionStats().ActiveAddress; expected != actual {
+		t.Errorf("expected active address %v, actual %v", expected, actual)
+	}
+}
+
 /********************     MOCKS     ********************/
 
 type mockConnection struct {
@@ -335,6 +480,10 @@ type mockConnection struct {
 	tubes              []string
 	listTubesError     error
 	listTubesCallCount int
+	jobs               map[uint64]map[string]string
+	statsJobError      error
+	bodies             map[uint64][]byte
+	deleted            []uint64
 }
 
 func (m *mockConnection) Stats() (map[string]string, error) {
@@ -347,10 +496,39 @@ func (m *mockConnection) ListTubes() ([]string, error) {
 	return m.tubes, m.listTubesError
 }
 
+func (m *mockConnection) StatsJob(id uint64) (map[string]string, error) {
+	if m.statsJobError != nil {
+		return nil, m.statsJobError
+	}
+	if stats, ok := m.jobs[id]; ok {
+		return stats, nil
+	}
+	return nil, beanstalk.ConnError{Op: "stats-job", Err: beanstalk.ErrNotFound}
+}
+
+func (m *mockConnection) Peek(id uint64) ([]byte, error) {
+	if body, ok := m.bodies[id]; ok {
+		return body, nil
+	}
+	return nil, beanstalk.ConnError{Op: "peek", Err: beanstalk.ErrNotFound}
+}
+
+func (m *mockConnection) Delete(id uint64) error {
+	m.deleted = append(m.deleted, id)
+	return nil
+}
+
 type mockTube struct {
 	stats          map[string]string
 	statsError     error
 	statsCallCount int
+	ready          uint64
+	delayed        uint64
+	buried         uint64
+	peekError      error
+	putID          uint64
+	putError       error
+	peekCallCount  int
 }
 
 func (m *mockTube) Stats() (map[string]string, error) {
@@ -358,15 +536,72 @@ func (m *mockTube) Stats() (map[string]string, error) {
 	return m.stats, m.statsError
 }
 
+func (m *mockTube) PeekReady() (uint64, []byte, error) {
+	return m.peek("peek-ready", m.ready)
+}
+
+func (m *mockTube) PeekDelayed() (uint64, []byte, error) {
+	return m.peek("peek-delayed", m.delayed)
+}
+
+func (m *mockTube) PeekBuried() (uint64, []byte, error) {
+	return m.peek("peek-buried", m.buried)
+}
+
+func (m *mockTube) Put(body []byte, pri uint32, delay, ttr time.Duration) (uint64, error) {
+	return m.putID, m.putError
+}
+
+// peek returns the job, or ErrNotFound when the job is zero.
+func (m *mockTube) peek(op string, id uint64) (uint64, []byte, error) {
+	m.peekCallCount++
+	if m.peekError != nil {
+		return 0, nil, m.peekError
+	}
+	if id == 0 {
+		return 0, nil, beanstalk.ConnError{Op: op, Err: beanstalk.ErrNotFound}
+	}
+	return id, []byte("body"), nil
+}
+
+type mockTubeSet struct {
+	reserved []uint64
+}
+
+// Reserve reserves the next job, or times out when there are none.
+func (m *mockTubeSet) Reserve(timeout time.Duration) (uint64, []byte, error) {
+	if len(m.reserved) == 0 {
+		return 0, nil, beanstalk.ConnError{Op: "reserve-with-timeout", Err: beanstalk.ErrTimeout}
+	}
+	id := m.reserved[0]
+	m.reserved = m.reserved[1:]
+	return id, []byte("body"), nil
+}
+
 type mockDialer struct {
 	conn      net.Conn
 	connError error
+	delay     time.Duration
 }
 
 func (m *mockDialer) Dial(network, address string) (net.Conn, error) {
+	time.Sleep(m.delay)
 	return m.conn, m.connError
 }
 
+type mockFailoverDialer struct {
+	conns  map[string]net.Conn
+	dialed []string
+}
+
+func (m *mockFailoverDialer) Dial(network, address string) (net.Conn, error) {
+	m.dialed = append(m.dialed, address)
+	if c, ok := m.conns[address]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("connection refused")
+}
+
 type mockNetConn struct {
 	bytes.Buffer
 }
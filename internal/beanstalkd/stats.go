@@ -13,6 +13,26 @@ type TubeStatsOrError struct {
 	Err   error
 }
 
+// JobStats is the map of beanstalkd job stats.
+type JobStats map[string]string
+
+// Job is a job in beanstalkd, with its body and (when
+// fetched) its stats.
+type Job struct {
+	ID    uint64
+	Body  []byte
+	Stats JobStats
+}
+
+// TubeHeadJobs are the stats of the jobs at the head of a tube's
+// ready, delayed and buried queues. The stats are nil when the
+// queue is empty.
+type TubeHeadJobs struct {
+	Ready   JobStats
+	Delayed JobStats
+	Buried  JobStats
+}
+
 // ManyTubeStats is the collection of tube stats
 // (or errors) for multiple tubes.
 type ManyTubeStats map[string]TubeStatsOrError
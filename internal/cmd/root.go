@@ -18,7 +18,7 @@ var (
 	flagBeanstalkdAddress = &cli.StringFlag{
 		Name:  "beanstalkd.address",
 		Value: "localhost:11300",
-		Usage: "address of beanstalkd process",
+		Usage: "comma separated addresses of beanstalkd, tried in order when connecting (e.g. an active/standby pair)",
 	}
 	flagBeanstalkdDialTimeout = &cli.UintFlag{
 		Name:  "beanstalkd.dialTimeout",
@@ -42,6 +42,27 @@ var (
 			return nil
 		},
 	}
+	flagBeanstalkdRetries = &cli.UintFlag{
+		Name:  "beanstalkd.retries",
+		Value: 1,
+		Usage: "number of times to reconnect and retry a command after a connection problem",
+	}
+	flagBeanstalkdBreakerThreshold = &cli.UintFlag{
+		Name:  "beanstalkd.breakerThreshold",
+		Value: 5,
+		Usage: "number of consecutive commands with connection problems before no more commands are sent for 'beanstalkd.breakerCooldown' (no circuit breaker when this is 0)",
+	}
+	flagBeanstalkdBreakerCooldown = &cli.UintFlag{
+		Name:  "beanstalkd.breakerCooldown",
+		Value: 30,
+		Usage: "seconds (> 0) to stop sending commands after the circuit breaker opens",
+		Action: func(ctx *cli.Context, v uint) error {
+			if v < 1 {
+				return fmt.Errorf("flag beanstalkd.breakerCooldown value < 1")
+			}
+			return nil
+		},
+	}
 	flagBeanstalkdSystemMetrics = &cli.StringFlag{
 		Name:  "beanstalkd.systemMetrics",
 		Value: "",
@@ -57,11 +78,224 @@ var (
 		Value: "",
 		Usage: "comma separated beanstalkd tubes for which to collect metrics (ignored when 'beanstalkd.allTubes' is true)",
 	}
+	flagBeanstalkdHeadJobTubes = &cli.StringFlag{
+		Name:  "beanstalkd.headJobTubes",
+		Value: "",
+		Usage: "comma separated beanstalkd tubes for which to peek at the jobs at the head of the ready, delayed and buried queues",
+	}
+	flagBeanstalkdBodySizeTubes = &cli.StringFlag{
+		Name:  "beanstalkd.bodySizeTubes",
+		Value: "",
+		Usage: "comma separated beanstalkd tubes for which to sample the size of the jobs at the head of the ready, delayed and buried queues",
+	}
+	flagBeanstalkdJobLabelTubes = &cli.StringFlag{
+		Name:  "beanstalkd.jobLabelTubes",
+		Value: "",
+		Usage: "comma separated beanstalkd tubes for which to sample the job at the head of the ready queue, labelled by a field of its JSON body",
+	}
+	flagBeanstalkdJobLabelField = &cli.StringFlag{
+		Name:  "beanstalkd.jobLabelField",
+		Value: "type",
+		Usage: "dotted path of the field in JSON job bodies to use as the 'job_type' label (e.g. 'meta.type')",
+	}
+	flagBeanstalkdJobLabelMaxValues = &cli.UintFlag{
+		Name:  "beanstalkd.jobLabelMaxValues",
+		Value: 20,
+		Usage: "maximum number of distinct 'job_type' labels (> 0) per tube, after which jobs are labelled '__other__'",
+		Action: func(ctx *cli.Context, v uint) error {
+			if v < 1 {
+				return fmt.Errorf("flag beanstalkd.jobLabelMaxValues value < 1")
+			}
+			return nil
+		},
+	}
 	flagBeanstalkdTubeMetrics = &cli.StringFlag{
 		Name:  "beanstalkd.tubeMetrics",
 		Value: "",
 		Usage: "comma separated beanstalkd tube metrics to collect for the targeted tubes (all metrics are collected when this is not set)",
 	}
+	flagBeanstalkdTubesRefreshInterval = &cli.UintFlag{
+		Name:  "beanstalkd.tubesRefreshInterval",
+		Value: 0,
+		Usage: "seconds to cache the list of tubes when 'beanstalkd.allTubes' is true (the list is refreshed on every scrape when this is 0)",
+	}
+	flagBeanstalkdTubesPerScrape = &cli.UintFlag{
+		Name:  "beanstalkd.tubesPerScrape",
+		Value: 0,
+		Usage: "maximum number of tubes to fetch on each scrape, rotating through all tubes (all tubes are fetched when this is 0)",
+	}
+	flagBeanstalkdTubesScrapeBudget = &cli.UintFlag{
+		Name:  "beanstalkd.tubesScrapeBudget",
+		Value: 0,
+		Usage: "maximum milliseconds to spend fetching tubes on each scrape, rotating through all tubes (no limit when this is 0)",
+	}
+	flagBeanstalkdPollInterval = &cli.UintFlag{
+		Name:  "beanstalkd.pollInterval",
+		Value: 0,
+		Usage: "seconds between polling beanstalkd in the background, serving the most recent poll on each scrape (beanstalkd is scraped on each scrape when this is 0)",
+	}
+	flagBeanstalkdMaxStaleness = &cli.UintFlag{
+		Name:  "beanstalkd.maxStaleness",
+		Value: 0,
+		Usage: "seconds after the most recent poll before beanstalkd is considered down (3 times 'beanstalkd.pollInterval' when this is 0)",
+	}
+	flagBeanstalkdScrapeReuseWindow = &cli.UintFlag{
+		Name:  "beanstalkd.scrapeReuseWindow",
+		Value: 0,
+		Usage: "milliseconds to reuse the result of a scrape for later scrapes (concurrent scrapes always share a single scrape of beanstalkd)",
+	}
+	flagBeanstalkdMinScrapeInterval = &cli.UintFlag{
+		Name:  "beanstalkd.minScrapeInterval",
+		Value: 0,
+		Usage: "minimum seconds between scrapes of beanstalkd, serving the previous result to scrapes within the interval (no minimum when this is 0)",
+	}
+	flagBeanstalkdMaxCommandsPerSecond = &cli.UintFlag{
+		Name:  "beanstalkd.maxCommandsPerSecond",
+		Value: 0,
+		Usage: "maximum number of commands sent to beanstalkd each second, across the connections of the scrapes, the buried jobs endpoint and the canary (no limit when this is 0)",
+	}
+	flagBeanstalkdFailurePolicy = &cli.StringFlag{
+		Name:  "beanstalkd.failurePolicy",
+		Value: "drop",
+		Usage: "what happens to the system and tube metrics when a scrape fails, either 'drop' them or 'keep' the most recent metrics for 'beanstalkd.staleGracePeriod'",
+		Action: func(ctx *cli.Context, v string) error {
+			if v != "drop" && v != "keep" {
+				return fmt.Errorf("flag beanstalkd.failurePolicy value %v is not 'drop' or 'keep'", v)
+			}
+			return nil
+		},
+	}
+	flagBeanstalkdStaleGracePeriod = &cli.UintFlag{
+		Name:  "beanstalkd.staleGracePeriod",
+		Value: 300,
+		Usage: "seconds after the last successful scrape to keep the most recent metrics, when 'beanstalkd.failurePolicy' is 'keep'",
+	}
+	flagBeanstalkdStitchCounters = &cli.BoolFlag{
+		Name:  "beanstalkd.stitchCounters",
+		Value: false,
+		Usage: "expose versions of the cumulative cmd_* and total_jobs_count system metrics that keep increasing across beanstalkd restarts",
+	}
+	flagBeanstalkdBuriedJobsMaxScan = &cli.UintFlag{
+		Name:  "beanstalkd.buriedJobsMaxScan",
+		Value: 1000,
+		Usage: "maximum number of the most recent job IDs to check when listing buried jobs",
+	}
+	flagBeanstalkdBuriedJobsBodyBytes = &cli.UintFlag{
+		Name:  "beanstalkd.buriedJobsBodyBytes",
+		Value: 256,
+		Usage: "maximum number of bytes of each job's body to include when listing buried jobs (0 = no bodies)",
+	}
+	flagBeanstalkdCensusWindow = &cli.UintFlag{
+		Name:  "beanstalkd.censusWindow",
+		Value: 0,
+		Usage: "number of the most recent job IDs to check in a background census of job states (0 = no census)",
+	}
+	flagBeanstalkdCensusInterval = &cli.UintFlag{
+		Name:  "beanstalkd.censusInterval",
+		Value: 60,
+		Usage: "seconds (> 0) between each census of job states",
+		Action: func(ctx *cli.Context, v uint) error {
+			if v < 1 {
+				return fmt.Errorf("flag beanstalkd.censusInterval value < 1")
+			}
+			return nil
+		},
+	}
+	flagBeanstalkdCensusCommandsPerSecond = &cli.UintFlag{
+		Name:  "beanstalkd.censusCommandsPerSecond",
+		Value: 100,
+		Usage: "maximum number of commands to send to beanstalkd each second when taking a census (0 = no limit)",
+	}
+	flagBeanstalkdStalledScrapes = &cli.UintFlag{
+		Name:  "beanstalkd.stalledScrapes",
+		Value: 5,
+		Usage: "number of scrapes (> 0) without any deletes, while ready jobs grow, before a tube is flagged as stalled",
+		Action: func(ctx *cli.Context, v uint) error {
+			if v < 1 {
+				return fmt.Errorf("flag beanstalkd.stalledScrapes value < 1")
+			}
+			return nil
+		},
+	}
+	flagBeanstalkdForecastThreshold = &cli.UintFlag{
+		Name:  "beanstalkd.forecastThreshold",
+		Value: 0,
+		Usage: "number of ready jobs of a tube for which to forecast the time until it's reached (no forecast when 0)",
+	}
+	flagBeanstalkdForecastWindow = &cli.UintFlag{
+		Name:  "beanstalkd.forecastWindow",
+		Value: 900,
+		Usage: "seconds (> 0) of scrapes over which to fit the forecast of each tube's ready jobs",
+		Action: func(ctx *cli.Context, v uint) error {
+			if v < 1 {
+				return fmt.Errorf("flag beanstalkd.forecastWindow value < 1")
+			}
+			return nil
+		},
+	}
+	flagBeanstalkdTubeChecks = &cli.StringFlag{
+		Name:  "beanstalkd.tubeChecks",
+		Value: "",
+		Usage: "comma separated checks of what's expected of tubes, each 'tube:check' or 'tube:check=limit', where the checks are exists, not_paused, min_watchers=N and max_ready=N",
+	}
+	flagBeanstalkdRulesFile = &cli.StringFlag{
+		Name:  "beanstalkd.rulesFile",
+		Value: "",
+		Usage: "JSON file of threshold rules on the system and tube stats, evaluated on each scrape (no rules when empty)",
+	}
+	flagBeanstalkdRuleWebhooks = &cli.StringFlag{
+		Name:  "beanstalkd.ruleWebhooks",
+		Value: "",
+		Usage: "comma separated URLs to which to POST a JSON notification when a rule fires or resolves",
+	}
+	flagBeanstalkdAlertmanagerURLs = &cli.StringFlag{
+		Name:  "beanstalkd.alertmanagerURLs",
+		Value: "",
+		Usage: "comma separated Alertmanager URLs to which to push the rules as alerts",
+	}
+	flagBeanstalkdAlertmanagerResend = &cli.UintFlag{
+		Name:  "beanstalkd.alertmanagerResend",
+		Value: 60,
+		Usage: "seconds (> 0) between resends of the firing alerts to Alertmanager",
+		Action: func(ctx *cli.Context, v uint) error {
+			if v < 1 {
+				return fmt.Errorf("flag beanstalkd.alertmanagerResend value < 1")
+			}
+			return nil
+		},
+	}
+	flagBeanstalkdMaintenanceFile = &cli.StringFlag{
+		Name:  "beanstalkd.maintenanceFile",
+		Value: "",
+		Usage: "JSON file of scheduled maintenance windows, during which the stalled and threshold signals of the tubes in maintenance are suppressed",
+	}
+	flagBeanstalkdCanaryTube = &cli.StringFlag{
+		Name:  "beanstalkd.canaryTube",
+		Value: "",
+		Usage: "dedicated tube in which to put, reserve and delete a canary job on each scrape (no canary when empty)",
+	}
+	flagBeanstalkdCanaryTimeout = &cli.UintFlag{
+		Name:  "beanstalkd.canaryTimeout",
+		Value: 5,
+		Usage: "seconds (> 0) to wait to reserve the canary job",
+		Action: func(ctx *cli.Context, v uint) error {
+			if v < 1 {
+				return fmt.Errorf("flag beanstalkd.canaryTimeout value < 1")
+			}
+			return nil
+		},
+	}
+	flagBeanstalkdMaxTrackedTubes = &cli.UintFlag{
+		Name:  "beanstalkd.maxTrackedTubes",
+		Value: 10000,
+		Usage: "maximum number of tubes (> 0) to remember across scrapes for the tube lifecycle metrics",
+		Action: func(ctx *cli.Context, v uint) error {
+			if v < 1 {
+				return fmt.Errorf("flag beanstalkd.maxTrackedTubes value < 1")
+			}
+			return nil
+		},
+	}
 	flagListenAddress = &cli.StringFlag{
 		Name:  "web.listen-address",
 		Value: ":8080",
@@ -72,6 +306,26 @@ var (
 		Value: "/metrics",
 		Usage: "path under which to expose metrics",
 	}
+	flagBuriedJobsPath = &cli.StringFlag{
+		Name:  "web.buried-jobs-path",
+		Value: "",
+		Usage: "path under which to list buried jobs (disabled when empty)",
+	}
+	flagMaintenancePath = &cli.StringFlag{
+		Name:  "web.maintenance-path",
+		Value: "",
+		Usage: "path under which to list, start and end maintenance windows (disabled when empty)",
+	}
+	flagMaintenanceWrites = &cli.BoolFlag{
+		Name:  "web.maintenance-writes",
+		Value: false,
+		Usage: "allow starting (POST) and ending (DELETE) maintenance windows under web.maintenance-path, which has no authentication",
+	}
+	flagConformancePath = &cli.StringFlag{
+		Name:  "web.conformance-path",
+		Value: "",
+		Usage: "path under which to summarise the tube checks (disabled when empty)",
+	}
 )
 
 func newApp() *cli.App {
@@ -86,12 +340,52 @@ func newApp() *cli.App {
 			flagBeanstalkdAddress,
 			flagBeanstalkdDialTimeout,
 			flagBeanstalkdKeepAlivePeriod,
+			flagBeanstalkdRetries,
+			flagBeanstalkdBreakerThreshold,
+			flagBeanstalkdBreakerCooldown,
 			flagBeanstalkdSystemMetrics,
 			flagBeanstalkdAllTubes,
 			flagBeanstalkdTubes,
+			flagBeanstalkdHeadJobTubes,
+			flagBeanstalkdBodySizeTubes,
+			flagBeanstalkdJobLabelTubes,
+			flagBeanstalkdJobLabelField,
+			flagBeanstalkdJobLabelMaxValues,
 			flagBeanstalkdTubeMetrics,
+			flagBeanstalkdTubesRefreshInterval,
+			flagBeanstalkdTubesPerScrape,
+			flagBeanstalkdTubesScrapeBudget,
+			flagBeanstalkdMaxTrackedTubes,
+			flagBeanstalkdPollInterval,
+			flagBeanstalkdMaxStaleness,
+			flagBeanstalkdScrapeReuseWindow,
+			flagBeanstalkdMinScrapeInterval,
+			flagBeanstalkdMaxCommandsPerSecond,
+			flagBeanstalkdFailurePolicy,
+			flagBeanstalkdStaleGracePeriod,
+			flagBeanstalkdStitchCounters,
+			flagBeanstalkdBuriedJobsMaxScan,
+			flagBeanstalkdBuriedJobsBodyBytes,
+			flagBeanstalkdCensusWindow,
+			flagBeanstalkdCensusInterval,
+			flagBeanstalkdCensusCommandsPerSecond,
+			flagBeanstalkdStalledScrapes,
+			flagBeanstalkdForecastThreshold,
+			flagBeanstalkdForecastWindow,
+			flagBeanstalkdTubeChecks,
+			flagBeanstalkdRulesFile,
+			flagBeanstalkdRuleWebhooks,
+			flagBeanstalkdAlertmanagerURLs,
+			flagBeanstalkdAlertmanagerResend,
+			flagBeanstalkdMaintenanceFile,
+			flagBeanstalkdCanaryTube,
+			flagBeanstalkdCanaryTimeout,
 			flagListenAddress,
 			flagMetricsPath,
+			flagBuriedJobsPath,
+			flagConformancePath,
+			flagMaintenancePath,
+			flagMaintenanceWrites,
 		},
 		Action: runCmd,
 	}
@@ -101,7 +395,11 @@ func runCmd(ctx *cli.Context) error {
 	if ctx.NArg() != 0 {
 		return cli.ShowAppHelp(ctx)
 	}
+	return httpserver.ListenAndServe(serverOpts(ctx), logger)
+}
 
+// serverOpts returns the options of the http server from the flags.
+func serverOpts(ctx *cli.Context) httpserver.Opts {
 	// Fetching all tubes overrides specific tubes.
 	beanstalkdAllTubes := ctx.Bool(flagBeanstalkdAllTubes.Name)
 	beanstalkdTubes := ctx.String(flagBeanstalkdTubes.Name)
@@ -109,19 +407,57 @@ func runCmd(ctx *cli.Context) error {
 		beanstalkdTubes = ""
 	}
 
-	serverOptions := httpserver.Opts{
-		BeanstalkdAddress:         ctx.String(flagBeanstalkdAddress.Name),
-		BeanstalkdDialTimeout:     ctx.Uint(flagBeanstalkdDialTimeout.Name),
-		BeanstalkdKeepAlivePeriod: ctx.Uint(flagBeanstalkdKeepAlivePeriod.Name),
-		BeanstalkdSystemMetrics:   toStringArray(ctx.String(flagBeanstalkdSystemMetrics.Name)),
-		BeanstalkdAllTubes:        beanstalkdAllTubes,
-		BeanstalkdTubes:           toStringArray(beanstalkdTubes),
-		BeanstalkdTubeMetrics:     toStringArray(ctx.String(flagBeanstalkdTubeMetrics.Name)),
-		ListenAddress:             ctx.String(flagListenAddress.Name),
-		MetricsPath:               ctx.String(flagMetricsPath.Name),
+	return httpserver.Opts{
+		BeanstalkdAddresses:               toStringArray(ctx.String(flagBeanstalkdAddress.Name)),
+		BeanstalkdDialTimeout:             ctx.Uint(flagBeanstalkdDialTimeout.Name),
+		BeanstalkdKeepAlivePeriod:         ctx.Uint(flagBeanstalkdKeepAlivePeriod.Name),
+		BeanstalkdRetries:                 ctx.Uint(flagBeanstalkdRetries.Name),
+		BeanstalkdBreakerThreshold:        ctx.Uint(flagBeanstalkdBreakerThreshold.Name),
+		BeanstalkdBreakerCooldown:         ctx.Uint(flagBeanstalkdBreakerCooldown.Name),
+		BeanstalkdSystemMetrics:           toStringArray(ctx.String(flagBeanstalkdSystemMetrics.Name)),
+		BeanstalkdAllTubes:                beanstalkdAllTubes,
+		BeanstalkdTubes:                   toStringArray(beanstalkdTubes),
+		BeanstalkdHeadJobTubes:            toStringArray(ctx.String(flagBeanstalkdHeadJobTubes.Name)),
+		BeanstalkdBodySizeTubes:           toStringArray(ctx.String(flagBeanstalkdBodySizeTubes.Name)),
+		BeanstalkdJobLabelTubes:           toStringArray(ctx.String(flagBeanstalkdJobLabelTubes.Name)),
+		BeanstalkdJobLabelField:           ctx.String(flagBeanstalkdJobLabelField.Name),
+		BeanstalkdJobLabelMaxValues:       ctx.Uint(flagBeanstalkdJobLabelMaxValues.Name),
+		BeanstalkdTubeMetrics:             toStringArray(ctx.String(flagBeanstalkdTubeMetrics.Name)),
+		BeanstalkdTubesRefreshInterval:    ctx.Uint(flagBeanstalkdTubesRefreshInterval.Name),
+		BeanstalkdTubesPerScrape:          ctx.Uint(flagBeanstalkdTubesPerScrape.Name),
+		BeanstalkdTubesScrapeBudget:       ctx.Uint(flagBeanstalkdTubesScrapeBudget.Name),
+		BeanstalkdMaxTrackedTubes:         ctx.Uint(flagBeanstalkdMaxTrackedTubes.Name),
+		BeanstalkdPollInterval:            ctx.Uint(flagBeanstalkdPollInterval.Name),
+		BeanstalkdMaxStaleness:            ctx.Uint(flagBeanstalkdMaxStaleness.Name),
+		BeanstalkdScrapeReuseWindow:       ctx.Uint(flagBeanstalkdScrapeReuseWindow.Name),
+		BeanstalkdMinScrapeInterval:       ctx.Uint(flagBeanstalkdMinScrapeInterval.Name),
+		BeanstalkdMaxCommandsPerSecond:    ctx.Uint(flagBeanstalkdMaxCommandsPerSecond.Name),
+		BeanstalkdFailurePolicy:           ctx.String(flagBeanstalkdFailurePolicy.Name),
+		BeanstalkdStaleGracePeriod:        ctx.Uint(flagBeanstalkdStaleGracePeriod.Name),
+		BeanstalkdStitchCounters:          ctx.Bool(flagBeanstalkdStitchCounters.Name),
+		BeanstalkdBuriedJobsMaxScan:       ctx.Uint(flagBeanstalkdBuriedJobsMaxScan.Name),
+		BeanstalkdBuriedJobsBodyBytes:     ctx.Uint(flagBeanstalkdBuriedJobsBodyBytes.Name),
+		BeanstalkdCensusWindow:            ctx.Uint(flagBeanstalkdCensusWindow.Name),
+		BeanstalkdCensusInterval:          ctx.Uint(flagBeanstalkdCensusInterval.Name),
+		BeanstalkdCensusCommandsPerSecond: ctx.Uint(flagBeanstalkdCensusCommandsPerSecond.Name),
+		BeanstalkdStalledScrapes:          ctx.Uint(flagBeanstalkdStalledScrapes.Name),
+		BeanstalkdForecastThreshold:       ctx.Uint(flagBeanstalkdForecastThreshold.Name),
+		BeanstalkdForecastWindow:          ctx.Uint(flagBeanstalkdForecastWindow.Name),
+		BeanstalkdTubeChecks:              toStringArray(ctx.String(flagBeanstalkdTubeChecks.Name)),
+		BeanstalkdRulesFile:               ctx.String(flagBeanstalkdRulesFile.Name),
+		BeanstalkdRuleWebhooks:            toStringArray(ctx.String(flagBeanstalkdRuleWebhooks.Name)),
+		BeanstalkdAlertmanagerURLs:        toStringArray(ctx.String(flagBeanstalkdAlertmanagerURLs.Name)),
+		BeanstalkdAlertmanagerResend:      ctx.Uint(flagBeanstalkdAlertmanagerResend.Name),
+		BeanstalkdMaintenanceFile:         ctx.String(flagBeanstalkdMaintenanceFile.Name),
+		BeanstalkdCanaryTube:              ctx.String(flagBeanstalkdCanaryTube.Name),
+		BeanstalkdCanaryTimeout:           ctx.Uint(flagBeanstalkdCanaryTimeout.Name),
+		ListenAddress:                     ctx.String(flagListenAddress.Name),
+		MetricsPath:                       ctx.String(flagMetricsPath.Name),
+		BuriedJobsPath:                    ctx.String(flagBuriedJobsPath.Name),
+		ConformancePath:                   ctx.String(flagConformancePath.Name),
+		MaintenancePath:                   ctx.String(flagMaintenancePath.Name),
+		MaintenanceWrites:                 ctx.Bool(flagMaintenanceWrites.Name),
 	}
-
-	return httpserver.ListenAndServe(serverOptions, logger)
 }
 
 func RunAndExit() {
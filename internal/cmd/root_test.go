@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/httpserver"
+	"github.com/urfave/cli/v2"
+)
+
+func TestServerOpts(t *testing.T) {
+	var opts httpserver.Opts
+	app := newApp()
+	app.Action = func(ctx *cli.Context) error {
+		opts = serverOpts(ctx)
+		return nil
+	}
+	err := app.Run([]string{
+		"beanstalkd_exporter",
+		"--beanstalkd.tubes=default,emails",
+		"--beanstalkd.tubesPerScrape=5",
+		"--beanstalkd.tubesScrapeBudget=250",
+		"--web.maintenance-path=/maintenance",
+	})
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+
+	// We expect the flags to reach the collector options.
+	collectorOpts := opts.CollectorOpts()
+	tests := []struct {
+		num      string
+		actual   interface{}
+		expected interface{}
+	}{
+		{num: "1) ", actual: len(collectorOpts.Tubes), expected: 2},
+		{num: "2) ", actual: collectorOpts.TubesPerScrape, expected: 5},
+		{num: "3) ", actual: collectorOpts.TubesScrapeBudget, expected: 250 * time.Millisecond},
+		// We expect maintenance windows not to be writable by default.
+		{num: "4) ", actual: opts.MaintenanceWrites, expected: false},
+	}
+	for _, tt := range tests {
+		if tt.expected != tt.actual {
+			t.Errorf(tt.num+"expected %v, actual %v", tt.expected, tt.actual)
+		}
+	}
+}
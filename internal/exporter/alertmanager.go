@@ -0,0 +1,174 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAlertmanagerResendInterval = time.Minute
+	defaultAlertSeverity              = "warning"
+
+	// alertmanagerTimeout is how long to wait for Alertmanager.
+	alertmanagerTimeout = 10 * time.Second
+	// alertEndsAtResends is the number of resends missed before
+	// Alertmanager resolves a firing alert by itself.
+	alertEndsAtResends = 4
+)
+
+// postableAlert is an alert as posted to Alertmanager's v2 API.
+type postableAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+// AlertmanagerNotifier pushes the rules as alerts to Alertmanager's v2
+// API, in the background. Firing alerts are resent every resend interval
+// until they resolve (including when their rule can no longer be
+// evaluated), and are resolved by Alertmanager by itself if the exporter
+// stops resending them.
+type AlertmanagerNotifier struct {
+	urls           []string
+	instance       string
+	resendInterval time.Duration
+	client         *http.Client
+	logger         *slog.Logger
+
+	mutex  sync.Mutex
+	firing map[string]RuleNotification
+	queued []RuleNotification
+	wake   chan struct{}
+
+	now func() time.Time
+}
+
+// NewAlertmanagerNotifier returns a notifier for the Alertmanagers at the
+// URLs, labelling the alerts with the instance. The alerts are sent once
+// it's running.
+func NewAlertmanagerNotifier(urls []string, instance string, resendInterval time.Duration, logger *slog.Logger) *AlertmanagerNotifier {
+	if resendInterval <= 0 {
+		resendInterval = defaultAlertmanagerResendInterval
+	}
+	alertsURLs := make([]string, 0, len(urls))
+	for _, url := range urls {
+		alertsURLs = append(alertsURLs, strings.TrimSuffix(url, "/")+"/api/v2/alerts")
+	}
+	return &AlertmanagerNotifier{
+		urls:           alertsURLs,
+		instance:       instance,
+		resendInterval: resendInterval,
+		client:         &http.Client{Timeout: alertmanagerTimeout},
+		logger:         logger,
+		firing:         make(map[string]RuleNotification),
+		wake:           make(chan struct{}, 1),
+		now:            time.Now,
+	}
+}
+
+// Notify queues the alert of the notification to be sent straight away,
+// and remembers the firing alerts to be resent.
+func (a *AlertmanagerNotifier) Notify(notification RuleNotification) {
+	a.mutex.Lock()
+	if notification.Status == RuleFiring {
+		a.firing[notification.Rule] = notification
+	} else {
+		delete(a.firing, notification.Rule)
+	}
+	a.queued = append(a.queued, notification)
+	a.mutex.Unlock()
+
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends the queued alerts as they're notified, and resends the
+// firing alerts every resend interval, until the context is done.
+func (a *AlertmanagerNotifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.resendInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.wake:
+			a.mutex.Lock()
+			notifications := a.queued
+			a.queued = nil
+			a.mutex.Unlock()
+			a.send(ctx, notifications)
+		case <-ticker.C:
+			a.mutex.Lock()
+			notifications := make([]RuleNotification, 0, len(a.firing))
+			for _, notification := range a.firing {
+				notifications = append(notifications, notification)
+			}
+			a.mutex.Unlock()
+			a.send(ctx, notifications)
+		}
+	}
+}
+
+// alert returns the alert for a notification. A firing alert ends after
+// a few missed resends, and a resolved alert ends when it resolved.
+func (a *AlertmanagerNotifier) alert(notification RuleNotification) postableAlert {
+	labels := map[string]string{
+		"alertname": notification.Rule,
+		"instance":  a.instance,
+		"severity":  notification.Severity,
+	}
+	if notification.Severity == "" {
+		labels["severity"] = defaultAlertSeverity
+	}
+	if notification.Tube != "" {
+		labels["tube"] = notification.Tube
+	}
+
+	annotations := map[string]string{
+		"summary": fmt.Sprintf("%v is %v (threshold %v)", notification.Stat, notification.Value, notification.Threshold),
+	}
+	for name, value := range notification.Annotations {
+		annotations[name] = value
+	}
+
+	endsAt := a.now().Add(alertEndsAtResends * a.resendInterval)
+	if notification.Status == RuleResolved {
+		endsAt = notification.At
+	}
+	return postableAlert{
+		Labels:      labels,
+		Annotations: annotations,
+		StartsAt:    notification.Since,
+		EndsAt:      endsAt,
+	}
+}
+
+// send posts the alerts of the notifications to each Alertmanager.
+func (a *AlertmanagerNotifier) send(ctx context.Context, notifications []RuleNotification) {
+	if len(notifications) == 0 {
+		return
+	}
+	alerts := make([]postableAlert, 0, len(notifications))
+	for _, notification := range notifications {
+		alerts = append(alerts, a.alert(notification))
+	}
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		a.logger.Error("error encoding alerts", "err", err)
+		return
+	}
+	for _, url := range a.urls {
+		if err := postJSON(ctx, a.client, url, body); err != nil {
+			a.logger.Error("error sending alerts to alertmanager", "url", url, "err", err)
+		}
+	}
+}
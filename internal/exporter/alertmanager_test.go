@@ -0,0 +1,173 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+func TestAlertmanagerNotifier(t *testing.T) {
+	received := make(chan []postableAlert, 10)
+	alertmanager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if expected, actual := "/api/v2/alerts", r.URL.Path; expected != actual {
+			t.Errorf("expected path %v, actual %v", expected, actual)
+		}
+		var alerts []postableAlert
+		if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+			t.Errorf("expected nil error, actual %v", err)
+		}
+		received <- alerts
+	}))
+	defer alertmanager.Close()
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	notifier := NewAlertmanagerNotifier([]string{alertmanager.URL + "/"}, "localhost:11300", 50*time.Millisecond, mockLogger())
+	notifier.now = func() time.Time { return now }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+
+	receive := func() []postableAlert {
+		select {
+		case alerts := <-received:
+			return alerts
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected alerts")
+		}
+		return nil
+	}
+
+	firing := RuleNotification{
+		Rule:        "emails_backlog",
+		Status:      RuleFiring,
+		Tube:        "emails",
+		Stat:        "current-jobs-ready",
+		Value:       1250,
+		Threshold:   1000,
+		Severity:    "critical",
+		Annotations: map[string]string{"runbook_url": "https://example.com/runbook"},
+		Since:       now.Add(-5 * time.Minute),
+		At:          now,
+	}
+	expectedFiring := []postableAlert{
+		{
+			Labels: map[string]string{
+				"alertname": "emails_backlog",
+				"instance":  "localhost:11300",
+				"severity":  "critical",
+				"tube":      "emails",
+			},
+			Annotations: map[string]string{
+				"summary":     "current-jobs-ready is 1250 (threshold 1000)",
+				"runbook_url": "https://example.com/runbook",
+			},
+			StartsAt: now.Add(-5 * time.Minute),
+			EndsAt:   now.Add(200 * time.Millisecond),
+		},
+	}
+
+	// We expect a firing alert to be sent straight away, and to be resent.
+	notifier.Notify(firing)
+	if actual := receive(); !reflect.DeepEqual(expectedFiring, actual) {
+		t.Errorf("expected %v, actual %v", expectedFiring, actual)
+	}
+	if actual := receive(); !reflect.DeepEqual(expectedFiring, actual) {
+		t.Errorf("expected resent %v, actual %v", expectedFiring, actual)
+	}
+
+	// We expect a resolved alert to end when it resolved, and not to be resent.
+	resolved := firing
+	resolved.Status = RuleResolved
+	resolved.At = now.Add(time.Minute)
+	// (skipping any resend already on its way).
+	notifier.Notify(resolved)
+	for alerts := receive(); !alerts[0].EndsAt.Equal(resolved.At); alerts = receive() {
+		if !alerts[0].EndsAt.Equal(expectedFiring[0].EndsAt) {
+			t.Fatalf("expected ends at %v, actual %v", resolved.At, alerts[0].EndsAt)
+		}
+	}
+	notifier.mutex.Lock()
+	firingAlerts := len(notifier.firing)
+	notifier.mutex.Unlock()
+	if expected := 0; expected != firingAlerts {
+		t.Errorf("expected %v firing alerts, actual %v", expected, firingAlerts)
+	}
+}
+
+func TestAlertmanagerTubeDisappears(t *testing.T) {
+	received := make(chan []postableAlert, 10)
+	alertmanager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alerts []postableAlert
+		if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+			t.Errorf("expected nil error, actual %v", err)
+		}
+		received <- alerts
+	}))
+	defer alertmanager.Close()
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	notifier := NewAlertmanagerNotifier([]string{alertmanager.URL}, "localhost:11300", 50*time.Millisecond, mockLogger())
+	notifier.now = func() time.Time { return now }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+
+	receive := func() []postableAlert {
+		select {
+		case alerts := <-received:
+			return alerts
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected alerts")
+		}
+		return nil
+	}
+
+	engine := newRuleEngine([]Rule{
+		{Name: "emails_backlog", Tube: "emails", Stat: "current-jobs-ready", Op: RuleAbove, Threshold: 1000},
+	}, []RuleNotifier{notifier})
+	engine.evaluate(nil, map[string]cachedTubeStats{
+		"emails": {stats: beanstalkd.TubeStats{"current-jobs-ready": "1250"}},
+	}, now, noMaintenance)
+	if actual := receive(); !actual[0].EndsAt.After(now) {
+		t.Errorf("expected a firing alert, actual %v", actual)
+	}
+
+	// We expect a resolved alert, ending when the tube disappeared,
+	// and the alert no longer to be resent (skipping any resend
+	// already on its way).
+	gone := now.Add(time.Minute)
+	engine.evaluate(nil, map[string]cachedTubeStats{}, gone, noMaintenance)
+	for alerts := receive(); !alerts[0].EndsAt.Equal(gone); {
+		alerts = receive()
+	}
+	notifier.mutex.Lock()
+	firingAlerts := len(notifier.firing)
+	notifier.mutex.Unlock()
+	if expected := 0; expected != firingAlerts {
+		t.Errorf("expected %v firing alerts, actual %v", expected, firingAlerts)
+	}
+}
+
+func TestAlertmanagerAlertDefaults(t *testing.T) {
+	notifier := NewAlertmanagerNotifier([]string{"http://localhost:9093"}, "localhost:11300", 0, mockLogger())
+
+	// We expect the default resend interval, and severity, and no tube label for a system stat.
+	if expected, actual := defaultAlertmanagerResendInterval, notifier.resendInterval; expected != actual {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+	alert := notifier.alert(RuleNotification{Rule: "no_workers", Status: RuleFiring, Stat: "current-workers", Threshold: 1})
+	expected := map[string]string{
+		"alertname": "no_workers",
+		"instance":  "localhost:11300",
+		"severity":  defaultAlertSeverity,
+	}
+	if !reflect.DeepEqual(expected, alert.Labels) {
+		t.Errorf("expected %v, actual %v", expected, alert.Labels)
+	}
+}
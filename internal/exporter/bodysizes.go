@@ -0,0 +1,81 @@
+package exporter
+
+import (
+	"sort"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// headJobsPeeker is implemented by a BeanstalkdServer that can
+// peek at the jobs at the head of a tube's queues.
+type headJobsPeeker interface {
+	PeekTubeHeadJobs(tube string) ([]beanstalkd.Job, error)
+}
+
+// bodySizeSampler samples the size of job bodies, by peeking at the
+// jobs at the head of a tube's queues. A job stays at the head of a
+// queue across scrapes, so each job is only sampled once.
+type bodySizeSampler struct {
+	server  headJobsPeeker
+	sampled map[string]map[uint64]bool
+
+	bodyBytes *prometheus.HistogramVec
+}
+
+func newBodySizeSampler(server headJobsPeeker) *bodySizeSampler {
+	return &bodySizeSampler{
+		server:  server,
+		sampled: make(map[string]map[uint64]bool),
+		bodyBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "tube_job_body_bytes",
+			Help:      "The size of the bodies of jobs sampled from the head of the ready, delayed and buried queues for this tube.",
+			Buckets:   prometheus.ExponentialBuckets(64, 4, 7),
+		}, []string{"tube"}),
+	}
+}
+
+// sample peeks at the head jobs of the tubes, observing the size
+// of each job that wasn't at the head of a queue last time.
+func (s *bodySizeSampler) sample(tubes []string) error {
+	sorted := make([]string, len(tubes))
+	copy(sorted, tubes)
+	sort.Strings(sorted)
+
+	sampled := make(map[string]map[uint64]bool, len(sorted))
+	for _, tube := range sorted {
+		jobs, err := s.server.PeekTubeHeadJobs(tube)
+		if err != nil {
+			return err
+		}
+		sampled[tube] = make(map[uint64]bool, len(jobs))
+		for _, job := range jobs {
+			sampled[tube][job.ID] = true
+			if s.sampled[tube][job.ID] {
+				continue
+			}
+			s.bodyBytes.WithLabelValues(tube).Observe(float64(len(job.Body)))
+		}
+	}
+	s.sampled = sampled
+	return nil
+}
+
+func (s *bodySizeSampler) describe(ch chan<- *prometheus.Desc) {
+	s.bodyBytes.Describe(ch)
+}
+
+func (s *bodySizeSampler) collect(ch chan<- prometheus.Metric) {
+	s.bodyBytes.Collect(ch)
+}
+
+// sampleBodySizes samples the job bodies of the configured tubes that
+// exist in beanstalkd. Peeking at a tube leaves the connection using
+// the default tube again, so sampling doesn't keep the tubes alive.
+func (b *BeanstalkdCollector) sampleBodySizes() error {
+	if b.bodySizes == nil {
+		return nil
+	}
+	return b.bodySizes.sample(b.existingTubes(b.opts.BodySizeTubes))
+}
@@ -0,0 +1,154 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+func TestBodySizeSampler(t *testing.T) {
+	server := &mockHeadJobsPeeker{
+		mockBeanstalkdServer: *mockHealthyBeanstalkd(),
+	}
+	collector, err := NewBeanstalkdCollector(
+		server,
+		CollectorOpts{
+			Tubes:         []string{"default", "anotherTube"},
+			BodySizeTubes: []string{"default", "missingTube"},
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if collector.bodySizes == nil {
+		t.Fatal("expected a body size sampler")
+	}
+
+	tests := []struct {
+		num           string
+		jobs          []beanstalkd.Job
+		expectedCount uint64
+		expectedSum   float64
+	}{
+		// We expect each head job to be sampled.
+		{
+			num:           "1) ",
+			jobs:          []beanstalkd.Job{{ID: 1, Body: make([]byte, 100)}, {ID: 2, Body: make([]byte, 10)}},
+			expectedCount: 2,
+			expectedSum:   110,
+		},
+		// We expect jobs still at the head not to be sampled again.
+		{
+			num:           "2) ",
+			jobs:          []beanstalkd.Job{{ID: 1, Body: make([]byte, 100)}, {ID: 3, Body: make([]byte, 1000)}},
+			expectedCount: 3,
+			expectedSum:   1110,
+		},
+		// We expect nothing to be sampled from empty queues.
+		{
+			num:           "3) ",
+			jobs:          nil,
+			expectedCount: 3,
+			expectedSum:   1110,
+		},
+	}
+
+	for _, tt := range tests {
+		server.jobs = map[string][]beanstalkd.Job{"default": tt.jobs}
+		collectAll(collector)
+		histogram := collectAll(collector.bodySizes.bodyBytes)
+		if expected, actual := 1, len(histogram); expected != actual {
+			t.Fatalf(tt.num+"expected %v histograms, actual %v", expected, actual)
+		}
+		h := readMetric(histogram[0]).GetHistogram()
+		if tt.expectedCount != h.GetSampleCount() {
+			t.Errorf(tt.num+"expected %v samples, actual %v", tt.expectedCount, h.GetSampleCount())
+		}
+		if tt.expectedSum != h.GetSampleSum() {
+			t.Errorf(tt.num+"expected %v bytes, actual %v", tt.expectedSum, h.GetSampleSum())
+		}
+	}
+
+	// We expect the tube that doesn't exist not to be peeked at.
+	for _, tube := range server.peeked {
+		if tube != "default" {
+			t.Errorf("expected only 'default' to be peeked, actual %v", tube)
+		}
+	}
+}
+
+func TestBodySizeSamplerRoundRobin(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	server := &mockHeadJobsPeeker{
+		mockBeanstalkdServer: *mockHealthyBeanstalkd(),
+	}
+	collector, err := NewBeanstalkdCollector(
+		server,
+		CollectorOpts{
+			AllTubes:       true,
+			TubesPerScrape: 1,
+			BodySizeTubes:  []string{"default", "anotherTube"},
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	collector.now = func() time.Time { return now }
+
+	// We expect only the tube fetched in each scrape to be sampled.
+	tests := []struct {
+		num      string
+		expected []string
+	}{
+		{num: "1) ", expected: []string{"anotherTube"}},
+		{num: "2) ", expected: []string{"default"}},
+	}
+	for _, tt := range tests {
+		server.peeked = nil
+		collectAll(collector)
+		if !reflect.DeepEqual(tt.expected, server.peeked) {
+			t.Errorf(tt.num+"expected to peek %v, actual %v", tt.expected, server.peeked)
+		}
+		now = now.Add(10 * time.Second)
+	}
+}
+
+func TestBodySizeSamplerError(t *testing.T) {
+	server := &mockHeadJobsPeeker{
+		mockBeanstalkdServer: *mockHealthyBeanstalkd(),
+		jobsError:            errUnexpected,
+	}
+	collector, err := NewBeanstalkdCollector(
+		server,
+		CollectorOpts{
+			Tubes:         []string{"default"},
+			BodySizeTubes: []string{"default"},
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	metrics := collectAll(collector)
+	if expected, actual := 0., readMetric(metrics[0]).GetGauge().GetValue(); expected != actual {
+		t.Errorf("expected 'up' value %v, actual %v", expected, actual)
+	}
+}
+
+/********************     MOCKS     ********************/
+
+type mockHeadJobsPeeker struct {
+	mockBeanstalkdServer
+	jobs      map[string][]beanstalkd.Job
+	jobsError error
+	peeked    []string
+}
+
+func (m *mockHeadJobsPeeker) PeekTubeHeadJobs(tube string) ([]beanstalkd.Job, error) {
+	m.peeked = append(m.peeked, tube)
+	return m.jobs[tube], m.jobsError
+}
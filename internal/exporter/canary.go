@@ -0,0 +1,98 @@
+package exporter
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const defaultCanaryTimeout = 5 * time.Second
+
+// CanaryProber can probe beanstalkd with a canary job.
+type CanaryProber interface {
+	ProbeCanary(tube string, timeout time.Duration) (time.Duration, error)
+}
+
+// canaryMetrics are the metrics about the canary probes, which put
+// a job into beanstalkd, reserve it and delete it on each scrape.
+type canaryMetrics struct {
+	server CanaryProber
+
+	// probing is whether a probe is in progress, and probed
+	// is called after each probe (when set).
+	probing atomic.Bool
+	probed  func()
+
+	duration prometheus.Histogram
+	probes   *prometheus.CounterVec
+	success  prometheus.Gauge
+}
+
+func newCanaryMetrics(server CanaryProber) *canaryMetrics {
+	return &canaryMetrics{
+		server: server,
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "canary_duration_seconds",
+			Help:      "The round trip time of successful canary probes, from putting the canary job to reserving it.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}),
+		probes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "canary_probes_total",
+			Help:      "The cumulative number of canary probes, by result (success or failure).",
+		}, []string{"result"}),
+		success: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "canary_success",
+			Help:      "Whether the most recent canary probe succeeded (1 = success, 0 = failure).",
+		}),
+	}
+}
+
+// probe probes beanstalkd with a canary job, in the tube.
+func (c *canaryMetrics) probe(tube string, timeout time.Duration) error {
+	duration, err := c.server.ProbeCanary(tube, timeout)
+	if err != nil {
+		c.probes.WithLabelValues("failure").Inc()
+		c.success.Set(0)
+		return err
+	}
+	c.probes.WithLabelValues("success").Inc()
+	c.success.Set(1)
+	c.duration.Observe(duration.Seconds())
+	return nil
+}
+
+func (c *canaryMetrics) describe(ch chan<- *prometheus.Desc) {
+	c.duration.Describe(ch)
+	c.probes.Describe(ch)
+	c.success.Describe(ch)
+}
+
+func (c *canaryMetrics) collect(ch chan<- prometheus.Metric) {
+	c.duration.Collect(ch)
+	c.probes.Collect(ch)
+	c.success.Collect(ch)
+}
+
+// probeCanary probes beanstalkd with a canary job (if configured), in
+// the background, so that waiting for the canary job doesn't hold up
+// the scrape. The metrics are of the most recent probe that finished,
+// and a probe isn't started while the previous one is in progress. A
+// failed probe doesn't fail the scrape, as beanstalkd may still answer.
+func (b *BeanstalkdCollector) probeCanary() {
+	if b.canary == nil || !b.canary.probing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		if err := b.canary.probe(b.opts.CanaryTube, b.opts.CanaryTimeout); err != nil {
+			b.logger.Error("error probing beanstalkd with a canary job", "tube", b.opts.CanaryTube, "err", err)
+		}
+		b.canary.probing.Store(false)
+		if b.canary.probed != nil {
+			b.canary.probed()
+		}
+	}()
+}
@@ -0,0 +1,105 @@
+package exporter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCanaryMetrics(t *testing.T) {
+	server := &mockCanaryProber{duration: 20 * time.Millisecond}
+	collector, err := NewBeanstalkdCollector(
+		mockHealthyBeanstalkd(),
+		CollectorOpts{CanaryTube: "canary", CanaryServer: server},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if collector.canary == nil {
+		t.Fatal("expected canary metrics")
+	}
+	var probed sync.WaitGroup
+	collector.canary.probed = probed.Done
+
+	tests := []struct {
+		num               string
+		probeError        error
+		expectedSuccesses float64
+		expectedFailures  float64
+		expectedSuccess   float64
+	}{
+		{num: "1) ", probeError: nil, expectedSuccesses: 1, expectedFailures: 0, expectedSuccess: 1},
+		{num: "2) ", probeError: errUnexpected, expectedSuccesses: 1, expectedFailures: 1, expectedSuccess: 0},
+		{num: "3) ", probeError: nil, expectedSuccesses: 2, expectedFailures: 1, expectedSuccess: 1},
+	}
+
+	for _, tt := range tests {
+		server.probeError = tt.probeError
+		probed.Add(1)
+		metrics := collectAll(collector)
+		probed.Wait()
+		// We expect a failed probe not to mark beanstalkd "down".
+		if expected, actual := 1., readMetric(metrics[0]).GetGauge().GetValue(); expected != actual {
+			t.Errorf(tt.num+"expected 'up' value %v, actual %v", expected, actual)
+		}
+		if actual := readCounter(collector.canary.probes.WithLabelValues("success")); tt.expectedSuccesses != actual {
+			t.Errorf(tt.num+"expected %v successes, actual %v", tt.expectedSuccesses, actual)
+		}
+		if actual := readCounter(collector.canary.probes.WithLabelValues("failure")); tt.expectedFailures != actual {
+			t.Errorf(tt.num+"expected %v failures, actual %v", tt.expectedFailures, actual)
+		}
+		if actual := readGauge(collector.canary.success); tt.expectedSuccess != actual {
+			t.Errorf(tt.num+"expected success %v, actual %v", tt.expectedSuccess, actual)
+		}
+	}
+
+	histogram := readMetric(collectAll(collector.canary.duration)[0]).GetHistogram()
+	if expected, actual := uint64(2), histogram.GetSampleCount(); expected != actual {
+		t.Errorf("expected %v durations, actual %v", expected, actual)
+	}
+	if expected, actual := "canary", server.tube; expected != actual {
+		t.Errorf("expected canary tube %v, actual %v", expected, actual)
+	}
+	if expected, actual := defaultCanaryTimeout, server.timeout; expected != actual {
+		t.Errorf("expected canary timeout %v, actual %v", expected, actual)
+	}
+
+	// We expect no probe to start while the previous one is in progress.
+	collector.canary.probing.Store(true)
+	collectAll(collector)
+	if expected, actual := 3, server.probes; expected != actual {
+		t.Errorf("expected %v probes, actual %v", expected, actual)
+	}
+}
+
+func TestNoCanaryMetrics(t *testing.T) {
+	// We expect no canary without its own server.
+	collector, err := NewBeanstalkdCollector(mockHealthyBeanstalkd(), CollectorOpts{CanaryTube: "canary"}, mockLogger())
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if collector.canary != nil {
+		t.Error("expected no canary metrics")
+	}
+}
+
+/********************     MOCKS     ********************/
+
+type mockCanaryProber struct {
+	duration   time.Duration
+	probeError error
+	tube       string
+	timeout    time.Duration
+	probes     int
+}
+
+func (m *mockCanaryProber) ProbeCanary(tube string, timeout time.Duration) (time.Duration, error) {
+	m.probes++
+	m.tube = tube
+	m.timeout = timeout
+	if m.probeError != nil {
+		return 0, m.probeError
+	}
+	return m.duration, nil
+}
@@ -0,0 +1,186 @@
+package exporter
+
+import (
+	"sort"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	censusAgeBuckets      = []float64{1, 10, 60, 300, 900, 3600, 21600, 86400}
+	censusReservesBuckets = []float64{0, 1, 2, 3, 5, 10, 20}
+	censusTTRBuckets      = []float64{0.25, 0.5, 0.75, 0.9, 1}
+)
+
+// BeanstalkdCensus is the minimum interface required by a CensusCollector.
+type BeanstalkdCensus interface {
+	Result() beanstalkd.CensusResult
+}
+
+// CensusCollector collects the distributions of the jobs found by
+// a census of beanstalkd, for consumption by Prometheus.
+type CensusCollector struct {
+	census BeanstalkdCensus
+
+	jobs         *prometheus.Desc
+	age          *prometheus.Desc
+	reserves     *prometheus.Desc
+	ttrUsed      *prometheus.Desc
+	scanned      *prometheus.Desc
+	newestID     *prometheus.Desc
+	lastFinished *prometheus.Desc
+	errors       *prometheus.Desc
+}
+
+// NewCensusCollector returns an initialised CensusCollector.
+func NewCensusCollector(census BeanstalkdCensus) *CensusCollector {
+	return &CensusCollector{
+		census: census,
+		jobs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "census", "jobs"),
+			"The number of jobs in the census window, by tube and state.",
+			[]string{"tube", "state"}, nil,
+		),
+		age: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "census", "job_age_seconds"),
+			"The age of the jobs in the census window, by tube and state.",
+			[]string{"tube", "state"}, nil,
+		),
+		reserves: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "census", "job_reserves"),
+			"The number of times the jobs in the census window have been reserved, by tube.",
+			[]string{"tube"}, nil,
+		),
+		ttrUsed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "census", "reserved_job_ttr_used_ratio"),
+			"The fraction of the time-to-run used by the reserved jobs in the census window, by tube.",
+			[]string{"tube"}, nil,
+		),
+		scanned: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "census", "scanned_jobs"),
+			"The number of job IDs checked by the most recent census.",
+			nil, nil,
+		),
+		newestID: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "census", "newest_job_id"),
+			"The newest job ID when the most recent census was taken.",
+			nil, nil,
+		),
+		lastFinished: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "census", "last_finished_timestamp_seconds"),
+			"The unix time when the most recent census finished.",
+			nil, nil,
+		),
+		errors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "census", "errors_total"),
+			"The cumulative number of censuses that failed.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe implements the prometheus.Collector interface
+// to describe the collected metrics.
+func (c *CensusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.jobs
+	ch <- c.age
+	ch <- c.reserves
+	ch <- c.ttrUsed
+	ch <- c.scanned
+	ch <- c.newestID
+	ch <- c.lastFinished
+	ch <- c.errors
+}
+
+// Collect implements the prometheus.Collector interface
+// to collect the results of the most recent census.
+func (c *CensusCollector) Collect(ch chan<- prometheus.Metric) {
+	result := c.census.Result()
+	ch <- prometheus.MustNewConstMetric(c.errors, prometheus.CounterValue, float64(result.Errors))
+	if result.FinishedAt.IsZero() {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.scanned, prometheus.GaugeValue, float64(result.Scanned))
+	ch <- prometheus.MustNewConstMetric(c.newestID, prometheus.GaugeValue, float64(result.NewestID))
+	ch <- prometheus.MustNewConstMetric(c.lastFinished, prometheus.GaugeValue, float64(result.FinishedAt.Unix()))
+
+	ages := make(map[[2]string]*constHistogram)
+	reserves := make(map[string]*constHistogram)
+	ttrUsed := make(map[string]*constHistogram)
+	for _, job := range result.Jobs {
+		key := [2]string{job.Tube, job.State}
+		if ages[key] == nil {
+			ages[key] = newConstHistogram(censusAgeBuckets)
+		}
+		ages[key].observe(float64(job.Age))
+
+		if reserves[job.Tube] == nil {
+			reserves[job.Tube] = newConstHistogram(censusReservesBuckets)
+		}
+		reserves[job.Tube].observe(float64(job.Reserves))
+
+		if job.State == "reserved" && job.TTR > 0 {
+			if ttrUsed[job.Tube] == nil {
+				ttrUsed[job.Tube] = newConstHistogram(censusTTRBuckets)
+			}
+			used := float64(job.TTR) - float64(job.TimeLeft)
+			ttrUsed[job.Tube].observe(used / float64(job.TTR))
+		}
+	}
+
+	keys := make([][2]string, 0, len(ages))
+	for key := range ages {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || (keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1])
+	})
+	for _, key := range keys {
+		h := ages[key]
+		ch <- prometheus.MustNewConstMetric(c.jobs, prometheus.GaugeValue, float64(h.count), key[0], key[1])
+		ch <- prometheus.MustNewConstHistogram(c.age, h.count, h.sum, h.buckets, key[0], key[1])
+	}
+	for _, tube := range sortedKeys(reserves) {
+		h := reserves[tube]
+		ch <- prometheus.MustNewConstHistogram(c.reserves, h.count, h.sum, h.buckets, tube)
+	}
+	for _, tube := range sortedKeys(ttrUsed) {
+		h := ttrUsed[tube]
+		ch <- prometheus.MustNewConstHistogram(c.ttrUsed, h.count, h.sum, h.buckets, tube)
+	}
+}
+
+// constHistogram accumulates observations for a const histogram.
+type constHistogram struct {
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+}
+
+func newConstHistogram(bounds []float64) *constHistogram {
+	buckets := make(map[float64]uint64, len(bounds))
+	for _, bound := range bounds {
+		buckets[bound] = 0
+	}
+	return &constHistogram{buckets: buckets}
+}
+
+func (h *constHistogram) observe(v float64) {
+	h.count++
+	h.sum += v
+	for bound := range h.buckets {
+		if v <= bound {
+			h.buckets[bound]++
+		}
+	}
+}
+
+func sortedKeys(m map[string]*constHistogram) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
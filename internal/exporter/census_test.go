@@ -0,0 +1,79 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+func TestCensusCollectorBeforeCensus(t *testing.T) {
+	collector := NewCensusCollector(&mockCensus{
+		result: beanstalkd.CensusResult{Errors: 2},
+	})
+
+	// We expect only the errors before the first census.
+	metrics := collectAll(collector)
+	if expected, actual := 1, len(metrics); expected != actual {
+		t.Fatalf("expected %v metrics, actual %v", expected, actual)
+	}
+	if expected, actual := 2., readMetric(metrics[0]).GetCounter().GetValue(); expected != actual {
+		t.Errorf("expected %v errors, actual %v", expected, actual)
+	}
+}
+
+func TestCensusCollector(t *testing.T) {
+	collector := NewCensusCollector(&mockCensus{
+		result: beanstalkd.CensusResult{
+			Jobs: []beanstalkd.CensusJob{
+				{ID: 4, Tube: "emails", State: "ready", Age: 5},
+				{ID: 3, Tube: "default", State: "reserved", Age: 60, Reserves: 2, TTR: 30, TimeLeft: 3},
+				{ID: 2, Tube: "default", State: "ready", Age: 100, Reserves: 1},
+				{ID: 1, Tube: "default", State: "ready", Age: 500},
+			},
+			Scanned:    4,
+			NewestID:   4,
+			FinishedAt: time.Unix(1700000000, 0),
+		},
+	})
+
+	// errors, scanned, newest ID, last finished, 3 x (jobs, age)
+	// for each tube and state, 2 reserves and 1 ttr used.
+	metrics := collectAll(collector)
+	if expected, actual := 13, len(metrics); expected != actual {
+		t.Fatalf("expected %v metrics, actual %v", expected, actual)
+	}
+
+	// default, ready
+	if expected, actual := 2., readMetric(metrics[4]).GetGauge().GetValue(); expected != actual {
+		t.Errorf("expected %v jobs, actual %v", expected, actual)
+	}
+	age := readMetric(metrics[5]).GetHistogram()
+	if expected, actual := 600., age.GetSampleSum(); expected != actual {
+		t.Errorf("expected age sum %v, actual %v", expected, actual)
+	}
+	for _, b := range age.GetBucket() {
+		if b.GetUpperBound() == 300 && b.GetCumulativeCount() != 1 {
+			t.Errorf("expected 1 job <= 300s, actual %v", b.GetCumulativeCount())
+		}
+	}
+
+	// default, ttr used
+	ttrUsed := readMetric(metrics[12]).GetHistogram()
+	if expected, actual := uint64(1), ttrUsed.GetSampleCount(); expected != actual {
+		t.Errorf("expected %v reserved jobs, actual %v", expected, actual)
+	}
+	if expected, actual := 0.9, ttrUsed.GetSampleSum(); expected != actual {
+		t.Errorf("expected ttr used %v, actual %v", expected, actual)
+	}
+}
+
+/********************     MOCKS     ********************/
+
+type mockCensus struct {
+	result beanstalkd.CensusResult
+}
+
+func (m *mockCensus) Result() beanstalkd.CensusResult {
+	return m.result
+}
@@ -3,8 +3,10 @@ package exporter
 import (
 	"fmt"
 	"log/slog"
+	"slices"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
 	"github.com/prometheus/client_golang/prometheus"
@@ -14,6 +16,14 @@ const (
 	namespace = "beanstalkd"
 )
 
+const (
+	// FailurePolicyDrop drops the beanstalkd metrics when a scrape fails.
+	FailurePolicyDrop = "drop"
+	// FailurePolicyKeep keeps the most recent beanstalkd metrics when
+	// a scrape fails, until the stale grace period has passed.
+	FailurePolicyKeep = "keep"
+)
+
 // BeanstalkdServer is the minimum interface required by a BeanstalkdCollector
 type BeanstalkdServer interface {
 	ListTubes() ([]string, error)
@@ -23,10 +33,108 @@ type BeanstalkdServer interface {
 
 // CollectorOpts contains the options for configuring the beanstalkd collector.
 type CollectorOpts struct {
-	SystemMetrics []string
-	AllTubes      bool
-	Tubes         []string
-	TubeMetrics   []string
+	SystemMetrics   []string
+	AllTubes        bool
+	Tubes           []string
+	TubeMetrics     []string
+	MaxTrackedTubes int
+
+	// TubesRefreshInterval is how long the list of tubes is cached
+	// when collecting all tubes. The list is refreshed on every
+	// scrape when this is zero.
+	TubesRefreshInterval time.Duration
+
+	// TubesPerScrape is the maximum number of tubes fetched on each
+	// scrape, and TubesScrapeBudget is the maximum time spent fetching
+	// tubes on each scrape. When either is set, the tubes are fetched
+	// in rotation, and the most recent stats are served for the others.
+	TubesPerScrape    int
+	TubesScrapeBudget time.Duration
+
+	// PollInterval is how often beanstalkd is polled in the background.
+	// When set, Collect serves the metrics from the most recent poll,
+	// and beanstalkd is "down" when they're older than MaxStaleness.
+	// When zero, beanstalkd is scraped on every call to Collect.
+	PollInterval time.Duration
+	MaxStaleness time.Duration
+
+	// ScrapeReuseWindow is how long the result of a scrape is reused
+	// by later calls to Collect, when not polling in the background.
+	ScrapeReuseWindow time.Duration
+
+	// MinScrapeInterval is the minimum time between scrapes of
+	// beanstalkd, when not polling in the background. Calls to
+	// Collect within this interval are throttled, and are served
+	// the result of the previous scrape.
+	MinScrapeInterval time.Duration
+
+	// FailurePolicy is what happens to the system and tube metrics when
+	// a scrape fails (FailurePolicyDrop by default). With FailurePolicyKeep,
+	// the most recent metrics are kept for StaleGracePeriod after the last
+	// successful scrape.
+	FailurePolicy    string
+	StaleGracePeriod time.Duration
+
+	// HeadJobTubes are the tubes for which the jobs at the head of the
+	// ready, delayed and buried queues are peeked at, to report how long
+	// jobs have been waiting. The tubes must also be scraped.
+	HeadJobTubes []string
+
+	// BodySizeTubes are the tubes for which the sizes of the jobs at the
+	// head of the ready, delayed and buried queues are sampled. The tubes
+	// must also be scraped.
+	BodySizeTubes []string
+
+	// JobLabelTubes are the tubes for which the job at the head of the
+	// ready queue is sampled, and labelled by the JobLabelField of its
+	// JSON body (a dotted path, "type" by default). Each tube has at
+	// most JobLabelMaxValues distinct labels. The tubes must also be
+	// scraped.
+	JobLabelTubes     []string
+	JobLabelField     string
+	JobLabelMaxValues int
+
+	// StalledScrapes is the number of scrapes without any deletes, while
+	// ready jobs grow, before a tube is flagged as stalled (5 by default).
+	StalledScrapes int
+
+	// ForecastThreshold is the number of ready jobs of a tube for which
+	// the time until it's reached is forecast, from a line fitted to the
+	// ready jobs over the ForecastWindow (15 minutes by default). There's
+	// no forecast when it's 0. Tubes must be scraped.
+	ForecastThreshold int
+	ForecastWindow    time.Duration
+
+	// TubeChecks are what's expected of tubes, checked on each scrape,
+	// each declared as "tube:check" or "tube:check=limit". The checks
+	// are "exists", "not_paused", "min_watchers=N" and "max_ready=N".
+	// The tubes must also be scraped.
+	TubeChecks []string
+
+	// Rules are thresholds on the system and tube stats, evaluated on
+	// each successful scrape. The RuleNotifiers are notified when the
+	// rules fire or resolve.
+	Rules         []Rule
+	RuleNotifiers []RuleNotifier
+
+	// Maintenance is the maintenance windows, during which the tubes in
+	// maintenance are flagged, and their stalled and threshold signals
+	// are suppressed. There's no maintenance when it's nil.
+	Maintenance *Maintenance
+
+	// CanaryTube is a dedicated tube in which a canary job is put,
+	// reserved and deleted on each scrape, waiting up to CanaryTimeout
+	// (5 seconds by default). The CanaryServer probes beanstalkd in the
+	// background, so it needs its own connection to beanstalkd (and no
+	// command observer, to keep the probes out of the command latency).
+	// There's no canary when either is empty.
+	CanaryTube    string
+	CanaryTimeout time.Duration
+	CanaryServer  CanaryProber
+
+	// StitchCounters exposes versions of the cumulative system metrics
+	// that keep increasing across beanstalkd restarts.
+	StitchCounters bool
 }
 
 // BeanstalkdCollector collects metrics from a beanstalkd server
@@ -34,15 +142,55 @@ type CollectorOpts struct {
 type BeanstalkdCollector struct {
 	beanstalkd BeanstalkdServer
 	mutex      sync.RWMutex
+	flight     flight
+	healthy    bool
+
+	lastSuccess time.Time
+	exposeStats bool
 
 	opts   CollectorOpts
 	logger *slog.Logger
 
 	systemMetrics map[string]prometheus.Gauge
 	tubesMetrics  map[string]*prometheus.GaugeVec
+	tubeExists    *prometheus.GaugeVec
+	missingTubes  map[string]bool
+	tubeTracker   *tubeTracker
+	restarts      *restartTracker
+	headJobs      *headJobsMetrics
+	bodySizes     *bodySizeSampler
+	jobLabels     *jobLabelSampler
+	canary        *canaryMetrics
 
-	totalScrapes prometheus.Counter
-	up           prometheus.Gauge
+	tubeList        []string
+	tubeListUpdated time.Time
+	tubeStats       map[string]cachedTubeStats
+	tubeStatsAt     time.Time
+	tubeCursor      string
+	tubesRotated    bool
+	tubeStatsAge    *prometheus.GaugeVec
+	stallDetector   *stallDetector
+	throughput      *throughputTracker
+	forecaster      *backlogForecaster
+	conformance     *conformanceChecker
+	systemStats     beanstalkd.ServerStats
+	rules           *ruleEngine
+	maintenance     *maintenanceMetrics
+
+	now func() time.Time
+
+	totalScrapes         prometheus.Counter
+	up                   prometheus.Gauge
+	lastPoll             prometheus.Gauge
+	throttledScrapes     prometheus.Counter
+	lastSuccessfulScrape prometheus.Gauge
+	connectionMetrics    *connectionMetrics
+	commandDuration      *prometheus.HistogramVec
+
+	snapshotMutex   sync.RWMutex
+	snapshot        []prometheus.Metric
+	snapshotHealthy bool
+	snapshotAt      time.Time
 }
 
 func (opts *CollectorOpts) validate() (err error) {
@@ -69,6 +217,95 @@ func (opts *CollectorOpts) validate() (err error) {
 		return
 	}
 
+	// Head jobs are only peeked at for tubes that are scraped.
+	if len(opts.HeadJobTubes) > 0 && len(opts.Tubes) == 0 && !opts.AllTubes {
+		err = fmt.Errorf("head job tubes without tubes is not supported")
+		return
+	}
+
+	// Body sizes are only sampled for tubes that are scraped.
+	if len(opts.BodySizeTubes) > 0 && len(opts.Tubes) == 0 && !opts.AllTubes {
+		err = fmt.Errorf("body size tubes without tubes is not supported")
+		return
+	}
+
+	// Job labels are only sampled for tubes that are scraped, and
+	// by default are the "type" field of the job body.
+	if len(opts.JobLabelTubes) > 0 && len(opts.Tubes) == 0 && !opts.AllTubes {
+		err = fmt.Errorf("job label tubes without tubes is not supported")
+		return
+	}
+	if opts.JobLabelField == "" {
+		opts.JobLabelField = defaultJobLabelField
+	}
+	if opts.JobLabelMaxValues < 0 {
+		err = fmt.Errorf("job label max values < 0")
+		return
+	}
+	if opts.JobLabelMaxValues == 0 {
+		opts.JobLabelMaxValues = defaultJobLabelMaxValues
+	}
+
+	// Tubes are stalled after a few scrapes without deletes by default.
+	if opts.StalledScrapes < 0 {
+		err = fmt.Errorf("stalled scrapes < 0")
+		return
+	}
+	if opts.StalledScrapes == 0 {
+		opts.StalledScrapes = defaultStalledScrapes
+	}
+
+	// Forecasts are fitted over a window of a few minutes by default.
+	if opts.ForecastThreshold < 0 {
+		err = fmt.Errorf("forecast threshold < 0")
+		return
+	}
+	if opts.ForecastThreshold > 0 && !opts.AllTubes && len(opts.Tubes) == 0 {
+		err = fmt.Errorf("forecast threshold without tubes is not supported")
+		return
+	}
+	if opts.ForecastWindow < 0 {
+		err = fmt.Errorf("forecast window < 0")
+		return
+	}
+	if opts.ForecastWindow == 0 {
+		opts.ForecastWindow = defaultForecastWindow
+	}
+
+	// Error on any invalid tube checks, or checks of tubes that aren't scraped.
+	seenChecks := make(map[conformanceCheck]bool)
+	for _, declaration := range opts.TubeChecks {
+		check, checkErr := parseConformanceCheck(declaration)
+		if checkErr != nil {
+			err = checkErr
+			return
+		}
+		if !opts.AllTubes && !slices.Contains(opts.Tubes, check.tube) {
+			err = fmt.Errorf("tube check of a tube that isn't scraped: %v", declaration)
+			return
+		}
+		check.limit = 0
+		if seenChecks[check] {
+			err = fmt.Errorf("duplicate tube check: %v", declaration)
+			return
+		}
+		seenChecks[check] = true
+	}
+
+	// Error on any invalid rules.
+	if err = validateRules(opts.Rules, opts.AllTubes, opts.Tubes); err != nil {
+		return
+	}
+
+	// The canary waits a few seconds for its job by default.
+	if opts.CanaryTimeout < 0 {
+		err = fmt.Errorf("canary timeout < 0")
+		return
+	}
+	if opts.CanaryTimeout == 0 {
+		opts.CanaryTimeout = defaultCanaryTimeout
+	}
+
 	// If there are no system metrics, fetch all of them.
 	if len(opts.SystemMetrics) == 0 {
 		for m := range descSystemMetrics {
@@ -83,6 +320,65 @@ func (opts *CollectorOpts) validate() (err error) {
 		}
 	}
 
+	// Remember a sensible number of tubes by default.
+	if opts.MaxTrackedTubes < 0 {
+		err = fmt.Errorf("max tracked tubes < 0")
+		return
+	}
+	if opts.MaxTrackedTubes == 0 {
+		opts.MaxTrackedTubes = defaultMaxTrackedTubes
+	}
+
+	if opts.TubesRefreshInterval < 0 {
+		err = fmt.Errorf("tubes refresh interval < 0")
+		return
+	}
+
+	if opts.TubesPerScrape < 0 {
+		err = fmt.Errorf("tubes per scrape < 0")
+		return
+	}
+	if opts.TubesScrapeBudget < 0 {
+		err = fmt.Errorf("tubes scrape budget < 0")
+		return
+	}
+
+	// When polling, the metrics can be a few polls old by default.
+	if opts.PollInterval < 0 {
+		err = fmt.Errorf("poll interval < 0")
+		return
+	}
+	if opts.MaxStaleness < 0 {
+		err = fmt.Errorf("max staleness < 0")
+		return
+	}
+	if opts.PollInterval > 0 && opts.MaxStaleness == 0 {
+		opts.MaxStaleness = 3 * opts.PollInterval
+	}
+
+	if opts.ScrapeReuseWindow < 0 {
+		err = fmt.Errorf("scrape reuse window < 0")
+		return
+	}
+	if opts.MinScrapeInterval < 0 {
+		err = fmt.Errorf("min scrape interval < 0")
+		return
+	}
+
+	// Drop the metrics of failed scrapes by default.
+	switch opts.FailurePolicy {
+	case "":
+		opts.FailurePolicy = FailurePolicyDrop
+	case FailurePolicyDrop, FailurePolicyKeep:
+	default:
+		err = fmt.Errorf("unknown failure policy: %v", opts.FailurePolicy)
+		return
+	}
+	if opts.StaleGracePeriod < 0 {
+		err = fmt.Errorf("stale grace period < 0")
+		return
+	}
+
 	err = nil
 	return
 }
@@ -123,12 +419,145 @@ func NewBeanstalkdCollector(beanstalkd BeanstalkdServer, opts CollectorOpts, log
 		}
 	}
 
-	return &BeanstalkdCollector{
+	// Configured tubes are reported as existing (or not) so that a
+	// missing tube doesn't look like a tube without any data.
+	var tubeExists *prometheus.GaugeVec
+	if len(opts.Tubes) > 0 {
+		tubeExists = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_exists",
+			Help:      "Whether the configured tube exists in beanstalkd (1 = exists, 0 = missing).",
+		}, []string{"tube"})
+	}
+
+	// Tubes are tracked across scrapes, whenever tubes are scraped.
+	var tracker *tubeTracker
+	if opts.AllTubes || len(opts.Tubes) > 0 {
+		tracker = newTubeTracker(opts.MaxTrackedTubes)
+	}
+
+	// When tubes are fetched in rotation, show how old the stats are.
+	var tubeStatsAge *prometheus.GaugeVec
+	if (opts.AllTubes || len(opts.Tubes) > 0) && opts.roundRobin() {
+		tubeStatsAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_stats_age_seconds",
+			Help:      "The number of seconds since the stats for this tube were fetched.",
+		}, []string{"tube"})
+	}
+
+	// Tubes are checked for stalled consumers, and their rates
+	// derived, whenever tubes are scraped.
+	var stalls *stallDetector
+	var throughput *throughputTracker
+	if opts.AllTubes || len(opts.Tubes) > 0 {
+		stalls = newStallDetector(opts.StalledScrapes)
+		throughput = newThroughputTracker()
+	}
+
+	var forecaster *backlogForecaster
+	if opts.ForecastThreshold > 0 {
+		forecaster = newBacklogForecaster(opts.ForecastThreshold, opts.ForecastWindow)
+	}
+
+	var conformance *conformanceChecker
+	if len(opts.TubeChecks) > 0 {
+		checks := make([]conformanceCheck, 0, len(opts.TubeChecks))
+		for _, declaration := range opts.TubeChecks {
+			check, _ := parseConformanceCheck(declaration)
+			checks = append(checks, check)
+		}
+		conformance = newConformanceChecker(checks)
+	}
+
+	var rules *ruleEngine
+	if len(opts.Rules) > 0 {
+		rules = newRuleEngine(opts.Rules, opts.RuleNotifiers)
+	}
+
+	var maintenance *maintenanceMetrics
+	if opts.Maintenance != nil {
+		maintenance = newMaintenanceMetrics(opts.Maintenance)
+	}
+
+	var lastPoll prometheus.Gauge
+	if opts.PollInterval > 0 {
+		lastPoll = prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "exporter_last_poll_timestamp_seconds",
+			Help:      "The unix time when beanstalkd was last polled.",
+		})
+	}
+
+	var throttledScrapes prometheus.Counter
+	if opts.MinScrapeInterval > 0 {
+		throttledScrapes = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_throttled_scrapes_total",
+			Help:      "The cumulative number of scrapes served the previous result because of the minimum scrape interval.",
+		})
+	}
+
+	// Peek at the head jobs of tubes, when the server can.
+	var headJobs *headJobsMetrics
+	if fetcher, ok := beanstalkd.(headJobsFetcher); ok && len(opts.HeadJobTubes) > 0 {
+		headJobs = newHeadJobsMetrics(fetcher)
+	}
+
+	// Sample the size of job bodies, when the server can.
+	var bodySizes *bodySizeSampler
+	if peeker, ok := beanstalkd.(headJobsPeeker); ok && len(opts.BodySizeTubes) > 0 {
+		bodySizes = newBodySizeSampler(peeker)
+	}
+
+	// Label sampled jobs from their bodies, when the server can.
+	var jobLabels *jobLabelSampler
+	if peeker, ok := beanstalkd.(readyJobPeeker); ok && len(opts.JobLabelTubes) > 0 {
+		jobLabels = newJobLabelSampler(peeker, opts.JobLabelField, opts.JobLabelMaxValues)
+	}
+
+	// Probe beanstalkd with a canary job, on the canary's server.
+	var canary *canaryMetrics
+	if opts.CanaryServer != nil && opts.CanaryTube != "" {
+		canary = newCanaryMetrics(opts.CanaryServer)
+	}
+
+	// Report on the connection to beanstalkd, when the server can.
+	var connMetrics *connectionMetrics
+	if statser, ok := beanstalkd.(connectionStatser); ok {
+		connMetrics = newConnectionMetrics(statser)
+	}
+
+	// Observe each command sent to beanstalkd, when the server can.
+	var commandDuration *prometheus.HistogramVec
+	setter, observable := beanstalkd.(commandObserverSetter)
+	if observable {
+		commandDuration = newCommandDuration()
+	}
+
+	collector := &BeanstalkdCollector{
 		beanstalkd:    beanstalkd,
 		opts:          opts,
 		logger:        logger,
 		systemMetrics: systemMetrics,
 		tubesMetrics:  tubesMetrics,
+		tubeExists:    tubeExists,
+		missingTubes:  make(map[string]bool),
+		tubeTracker:   tracker,
+		restarts:      newRestartTracker(opts.SystemMetrics, opts.StitchCounters),
+		headJobs:      headJobs,
+		bodySizes:     bodySizes,
+		jobLabels:     jobLabels,
+		canary:        canary,
+		tubeStats:     make(map[string]cachedTubeStats),
+		tubeStatsAge:  tubeStatsAge,
+		stallDetector: stalls,
+		throughput:    throughput,
+		forecaster:    forecaster,
+		conformance:   conformance,
+		rules:         rules,
+		maintenance:   maintenance,
+		now:           time.Now,
 		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
 			Namespace: namespace,
 			Name:      "exporter_scrapes_total",
@@ -139,7 +568,20 @@ func NewBeanstalkdCollector(beanstalkd BeanstalkdServer, opts CollectorOpts, log
 			Name:      "up",
 			Help:      "Current health status of the backend (1 = UP, 0 = DOWN).",
 		}),
-	}, nil
+		lastPoll:         lastPoll,
+		throttledScrapes: throttledScrapes,
+		lastSuccessfulScrape: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_successful_scrape_timestamp_seconds",
+			Help:      "The unix time of the last successful scrape of beanstalkd.",
+		}),
+		connectionMetrics: connMetrics,
+		commandDuration:   commandDuration,
+	}
+	if observable {
+		setter.SetCommandObserver(collector.ObserveCommand)
+	}
+	return collector, nil
 }
 
 // Describe implements the prometheus.Collector interface
@@ -147,36 +589,145 @@ func NewBeanstalkdCollector(beanstalkd BeanstalkdServer, opts CollectorOpts, log
 func (b *BeanstalkdCollector) Describe(ch chan<- *prometheus.Desc) {
 	b.up.Describe(ch)
 	b.totalScrapes.Describe(ch)
+	b.lastSuccessfulScrape.Describe(ch)
 	for _, m := range b.systemMetrics {
 		m.Describe(ch)
 	}
+	b.restarts.describe(ch)
 	for _, m := range b.tubesMetrics {
 		m.Describe(ch)
 	}
+	if b.tubeExists != nil {
+		b.tubeExists.Describe(ch)
+	}
+	if b.tubeTracker != nil {
+		b.tubeTracker.describe(ch)
+	}
+	if b.tubeStatsAge != nil {
+		b.tubeStatsAge.Describe(ch)
+	}
+	if b.stallDetector != nil {
+		b.stallDetector.describe(ch)
+	}
+	if b.throughput != nil {
+		b.throughput.describe(ch)
+	}
+	if b.forecaster != nil {
+		b.forecaster.describe(ch)
+	}
+	if b.conformance != nil {
+		b.conformance.describe(ch)
+	}
+	if b.rules != nil {
+		b.rules.describe(ch)
+	}
+	if b.maintenance != nil {
+		b.maintenance.describe(ch)
+	}
+	if b.headJobs != nil {
+		b.headJobs.describe(ch)
+	}
+	if b.bodySizes != nil {
+		b.bodySizes.describe(ch)
+	}
+	if b.jobLabels != nil {
+		b.jobLabels.describe(ch)
+	}
+	if b.canary != nil {
+		b.canary.describe(ch)
+	}
+	if b.lastPoll != nil {
+		b.lastPoll.Describe(ch)
+	}
+	if b.throttledScrapes != nil {
+		b.throttledScrapes.Describe(ch)
+	}
+	if b.connectionMetrics != nil {
+		b.connectionMetrics.describe(ch)
+	}
+	if b.commandDuration != nil {
+		b.commandDuration.Describe(ch)
+	}
 }
 
 // Collect implements the prometheus.Collector interface
 // to collect the beanstalkd metrics.
 func (b *BeanstalkdCollector) Collect(ch chan<- prometheus.Metric) {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
-
-	b.resetMetrics()
-	b.scrape()
+	// Unless polling in the background, scrape beanstalkd now
+	// (or share a concurrent or very recent scrape).
+	if b.opts.PollInterval == 0 {
+		b.refresh()
+	}
+	b.collectSnapshot(ch)
+}
 
-	b.up.Collect(ch)
+// collectMetrics collects all metrics except for "up". The system
+// and tube metrics are only collected when the failure policy allows.
+func (b *BeanstalkdCollector) collectMetrics(ch chan<- prometheus.Metric) {
 	b.totalScrapes.Collect(ch)
-	for _, m := range b.systemMetrics {
-		m.Collect(ch)
+	b.lastSuccessfulScrape.Collect(ch)
+	if b.exposeStats {
+		for _, m := range b.systemMetrics {
+			m.Collect(ch)
+		}
+		for _, m := range b.tubesMetrics {
+			m.Collect(ch)
+		}
+		if b.tubeStatsAge != nil {
+			b.tubeStatsAge.Collect(ch)
+		}
+		if b.stallDetector != nil {
+			b.stallDetector.collect(ch)
+		}
+		if b.throughput != nil {
+			b.throughput.collect(ch)
+		}
+		if b.forecaster != nil {
+			b.forecaster.collect(ch)
+		}
+		if b.conformance != nil {
+			b.conformance.collect(ch)
+		}
+		if b.headJobs != nil {
+			b.headJobs.collect(ch)
+		}
 	}
-	for _, m := range b.tubesMetrics {
-		m.Collect(ch)
+	b.restarts.collect(ch, b.exposeStats)
+	if b.tubeExists != nil {
+		b.tubeExists.Collect(ch)
+	}
+	if b.tubeTracker != nil {
+		b.tubeTracker.collect(ch)
+	}
+	if b.bodySizes != nil {
+		b.bodySizes.collect(ch)
+	}
+	if b.jobLabels != nil {
+		b.jobLabels.collect(ch, b.exposeStats)
+	}
+	if b.canary != nil {
+		b.canary.collect(ch)
+	}
+	if b.rules != nil {
+		b.rules.collect(ch)
+	}
+	if b.maintenance != nil {
+		b.maintenance.collect(ch)
+	}
+	if b.lastPoll != nil {
+		b.lastPoll.Collect(ch)
+	}
+	if b.connectionMetrics != nil {
+		b.connectionMetrics.collect(ch)
+	}
+	if b.commandDuration != nil {
+		b.commandDuration.Collect(ch)
 	}
 }
 
 func (b *BeanstalkdCollector) resetMetrics() {
-	for _, m := range b.tubesMetrics {
-		m.Reset()
+	if b.tubeExists != nil {
+		b.tubeExists.Reset()
 	}
 }
 
@@ -188,7 +739,9 @@ func (b *BeanstalkdCollector) scrape() {
 		if err != nil {
 			b.logger.Error("error scraping beanstalkd", "err", err)
 			b.up.Set(0)
+			b.healthy = false
 		}
+		b.applyFailurePolicy()
 	}()
 
 	// We've done another scrape.
@@ -196,6 +749,15 @@ func (b *BeanstalkdCollector) scrape() {
 
 	// So far beanstalkd is up.
 	b.up.Set(1)
+	b.healthy = true
+
+	// Check that beanstalkd can accept and deliver jobs.
+	b.probeCanary()
+
+	// Find the maintenance windows in progress.
+	if b.maintenance != nil {
+		b.maintenance.refresh()
+	}
 
 	// Fetch the system stats from beanstalkd.
 	err = b.scrapeSystemStats()
@@ -208,6 +770,23 @@ func (b *BeanstalkdCollector) scrape() {
 	if err != nil {
 		return
 	}
+
+	// Peek at the jobs at the head of the tubes.
+	err = b.scrapeHeadJobs()
+	if err != nil {
+		return
+	}
+	err = b.sampleBodySizes()
+	if err != nil {
+		return
+	}
+	err = b.sampleJobLabels()
+	if err != nil {
+		return
+	}
+
+	// Evaluate the rules against the stats of this scrape.
+	b.evaluateRules()
 }
 
 func (b *BeanstalkdCollector) scrapeSystemStats() error {
@@ -215,6 +794,10 @@ func (b *BeanstalkdCollector) scrapeSystemStats() error {
 	if err != nil {
 		return err
 	}
+	b.systemStats = systemStats
+	if b.restarts.observe(systemStats, b.now()) {
+		b.logger.Info("beanstalkd restart detected", "pid", systemStats["pid"], "uptime", systemStats["uptime"])
+	}
 	for stat, value := range systemStats {
 		if _, ok := b.systemMetrics[stat]; ok {
 			v, err := strconv.ParseInt(value, 10, 64)
@@ -233,39 +816,210 @@ func (b *BeanstalkdCollector) scrapeTubesStats() (err error) {
 	if err != nil {
 		return
 	}
-	tubes := make(map[string]bool)
-	for _, tube := range tubeNames {
-		tubes[tube] = true
-	}
-	manyTubesStats, err := b.beanstalkd.FetchTubesStats(tubes)
+	fetched, manyTubesStats, err := b.fetchTubesStats(tubeNames)
 	if err != nil {
 		return
 	}
-	for tube, statsOrErr := range manyTubesStats {
+	// Each tube has been fetched once the last tube is fetched.
+	if len(tubeNames) > 0 && fetched[lastTube(tubeNames)] {
+		b.tubesRotated = true
+	}
+
+	// Remember the stats of the fetched tubes, and forget the
+	// fetched tubes that don't exist.
+	now := b.now()
+	b.tubeStatsAt = now
+	for tube := range fetched {
+		statsOrErr, ok := manyTubesStats[tube]
+		if !ok {
+			delete(b.tubeStats, tube)
+			continue
+		}
 		if statsOrErr.Err != nil {
 			err = statsOrErr.Err
+			continue
+		}
+		b.tubeStats[tube] = cachedTubeStats{
+			stats:     statsOrErr.Stats,
+			fetchedAt: now,
+		}
+	}
+
+	// Forget the tubes that are no longer scraped.
+	scraped := make(map[string]bool, len(tubeNames))
+	for _, tube := range tubeNames {
+		scraped[tube] = true
+	}
+	for tube := range b.tubeStats {
+		if !scraped[tube] {
+			delete(b.tubeStats, tube)
+		}
+	}
+
+	b.checkConfiguredTubes(fetched, manyTubesStats)
+	b.trackTubes()
+
+	// A listed tube that no longer exists means the cached
+	// list of tubes is out of date.
+	if b.opts.AllTubes && len(manyTubesStats) < len(fetched) {
+		b.tubeList = nil
+	}
+
+	if tubesErr := b.setTubesMetrics(now); tubesErr != nil {
+		err = tubesErr
+	}
+	if b.stallDetector != nil {
+		b.stallDetector.observe(b.tubeStats, now, b.inMaintenance)
+	}
+	if b.maintenance != nil {
+		b.maintenance.observe(b.tubeStats)
+	}
+	if b.throughput != nil {
+		b.throughput.observe(b.tubeStats)
+	}
+	if b.forecaster != nil {
+		b.forecaster.observe(b.tubeStats)
+	}
+	if b.conformance != nil {
+		// The scraped tubes without stats that weren't fetched
+		// are still waiting for their turn.
+		pending := make(map[string]bool)
+		for _, tube := range tubeNames {
+			if _, ok := b.tubeStats[tube]; !ok && !fetched[tube] {
+				pending[tube] = true
+			}
 		}
-		for stat, value := range statsOrErr.Stats {
+		b.conformance.observe(b.tubeStats, pending)
+	}
+	return
+}
+
+// setTubesMetrics sets the tube metrics from the most recent
+// stats of each tube, replacing the metrics of previous scrapes.
+func (b *BeanstalkdCollector) setTubesMetrics(now time.Time) (err error) {
+	for _, m := range b.tubesMetrics {
+		m.Reset()
+	}
+	if b.tubeStatsAge != nil {
+		b.tubeStatsAge.Reset()
+	}
+	for tube, cached := range b.tubeStats {
+		for stat, value := range cached.stats {
 			if _, ok := b.tubesMetrics[stat]; ok {
-				var v int64
-				v, err = strconv.ParseInt(value, 10, 64)
-				if err == nil {
-					b.tubesMetrics[stat].WithLabelValues(tube).Set(float64(v))
+				v, parseErr := strconv.ParseInt(value, 10, 64)
+				if parseErr != nil {
+					err = parseErr
+					continue
 				}
+				b.tubesMetrics[stat].WithLabelValues(tube).Set(float64(v))
 			}
 		}
+		if b.tubeStatsAge != nil {
+			b.tubeStatsAge.WithLabelValues(tube).Set(now.Sub(cached.fetchedAt).Seconds())
+		}
 	}
 	return
 }
 
+// applyFailurePolicy decides whether the system and tube metrics are
+// exposed after a scrape. They're always exposed after a successful
+// scrape. After a failed scrape, they're only exposed when keeping
+// them, and the last successful scrape is within the grace period.
+func (b *BeanstalkdCollector) applyFailurePolicy() {
+	now := b.now()
+	if b.healthy {
+		b.lastSuccess = now
+		b.lastSuccessfulScrape.Set(float64(now.Unix()))
+		b.exposeStats = true
+		return
+	}
+	b.exposeStats = b.opts.FailurePolicy == FailurePolicyKeep &&
+		!b.lastSuccess.IsZero() &&
+		now.Sub(b.lastSuccess) <= b.opts.StaleGracePeriod
+}
+
 func (b *BeanstalkdCollector) getTubesToScrape() ([]string, error) {
-	var err error
-	tubeNames := b.opts.Tubes
-	if b.opts.AllTubes {
-		tubeNames, err = b.beanstalkd.ListTubes()
-		if err != nil {
-			return nil, err
+	if !b.opts.AllTubes {
+		// Specific tubes that don't exist are skipped
+		// when fetching their stats.
+		return b.opts.Tubes, nil
+	}
+	return b.listTubes()
+}
+
+// listTubes returns the cached list of tubes, refreshing it from
+// beanstalkd when it's older than the tubes refresh interval.
+func (b *BeanstalkdCollector) listTubes() ([]string, error) {
+	now := b.now()
+	if b.tubeList != nil && now.Sub(b.tubeListUpdated) < b.opts.TubesRefreshInterval {
+		return b.tubeList, nil
+	}
+	tubes, err := b.beanstalkd.ListTubes()
+	if err != nil {
+		return nil, err
+	}
+	b.tubeList = tubes
+	b.tubeListUpdated = now
+	return tubes, nil
+}
+
+// checkConfiguredTubes reports whether each of the configured tubes
+// exists in beanstalkd. A tube is missing when it was fetched but
+// isn't in the fetched tube stats. A tube that hasn't been fetched
+// yet isn't reported. A warning is logged when a tube goes missing
+// (including on the first scrape), rather than on every scrape.
+func (b *BeanstalkdCollector) checkConfiguredTubes(fetched map[string]bool, manyTubesStats beanstalkd.ManyTubeStats) {
+	if b.tubeExists == nil {
+		return
+	}
+	for _, tube := range b.opts.Tubes {
+		_, remembered := b.tubeStats[tube]
+		_, found := manyTubesStats[tube]
+		missing := b.missingTubes[tube]
+		if fetched[tube] {
+			missing = !found
+		}
+		if !missing && !remembered && !found {
+			continue
 		}
+		if !missing {
+			b.tubeExists.WithLabelValues(tube).Set(1)
+			if b.missingTubes[tube] {
+				b.logger.Info("configured tube exists", "tube", tube)
+				delete(b.missingTubes, tube)
+			}
+			continue
+		}
+		b.tubeExists.WithLabelValues(tube).Set(0)
+		if !b.missingTubes[tube] {
+			b.logger.Warn("configured tube does not exist", "tube", tube)
+			b.missingTubes[tube] = true
+		}
+	}
+}
+
+// trackTubes remembers the tubes that exist in this scrape, so that
+// tubes coming and going between scrapes are counted. In round-robin
+// mode, the tubes are only tracked once each of them has been fetched,
+// so that the tubes fetched later in the first rotation aren't
+// counted as created.
+func (b *BeanstalkdCollector) trackTubes() {
+	if b.tubeTracker == nil || (b.opts.roundRobin() && !b.tubesRotated) {
+		return
+	}
+	tubes := make([]string, 0, len(b.tubeStats))
+	for tube := range b.tubeStats {
+		tubes = append(tubes, tube)
+	}
+	wasFull := b.tubeTracker.full
+	created, disappeared := b.tubeTracker.observe(tubes, b.now())
+	if len(created) > 0 {
+		b.logger.Debug("tubes created", "tubes", created)
+	}
+	if len(disappeared) > 0 {
+		b.logger.Debug("tubes disappeared", "tubes", disappeared)
+	}
+	if b.tubeTracker.full && !wasFull {
+		b.logger.Warn("too many tubes to track, ignoring new tubes (they're counted as created when there's room)", "max", b.opts.MaxTrackedTubes)
 	}
-	return tubeNames, nil
 }
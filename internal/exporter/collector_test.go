@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"log/slog"
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
 	"github.com/prometheus/client_golang/prometheus"
@@ -56,6 +59,156 @@ func TestValidateErrors(t *testing.T) {
 			opts:          CollectorOpts{AllTubes: false, TubeMetrics: []string{"tube_current_jobs_ready_count"}},
 			expectedError: "tube metrics without tubes is not supported",
 		},
+		// If head job tubes are requested, we must have tubes.
+		{
+			opts:          CollectorOpts{HeadJobTubes: []string{"default"}},
+			expectedError: "head job tubes without tubes is not supported",
+		},
+		// If body size tubes are requested, we must have tubes.
+		{
+			opts:          CollectorOpts{BodySizeTubes: []string{"default"}},
+			expectedError: "body size tubes without tubes is not supported",
+		},
+		// If job label tubes are requested, we must have tubes.
+		{
+			opts:          CollectorOpts{JobLabelTubes: []string{"default"}},
+			expectedError: "job label tubes without tubes is not supported",
+		},
+		// We expect an error when the job label max values is negative.
+		{
+			opts:          CollectorOpts{AllTubes: true, JobLabelMaxValues: -1},
+			expectedError: "job label max values < 0",
+		},
+		// We expect an error when the stalled scrapes is negative.
+		{
+			opts:          CollectorOpts{AllTubes: true, StalledScrapes: -1},
+			expectedError: "stalled scrapes < 0",
+		},
+		// We expect an error when the forecast threshold is negative.
+		{
+			opts:          CollectorOpts{AllTubes: true, ForecastThreshold: -1},
+			expectedError: "forecast threshold < 0",
+		},
+		// We expect an error when forecasting without tubes.
+		{
+			opts:          CollectorOpts{ForecastThreshold: 1000},
+			expectedError: "forecast threshold without tubes is not supported",
+		},
+		// We expect an error when the forecast window is negative.
+		{
+			opts:          CollectorOpts{AllTubes: true, ForecastThreshold: 1000, ForecastWindow: -1},
+			expectedError: "forecast window < 0",
+		},
+		// We expect an error for an invalid tube check.
+		{
+			opts:          CollectorOpts{AllTubes: true, TubeChecks: []string{"default:empty"}},
+			expectedError: "unknown tube check: default:empty",
+		},
+		// We expect an error when checking a tube that isn't scraped.
+		{
+			opts:          CollectorOpts{Tubes: []string{"default"}, TubeChecks: []string{"anotherTube:exists"}},
+			expectedError: "tube check of a tube that isn't scraped: anotherTube:exists",
+		},
+		// We expect an error for a duplicate tube check.
+		{
+			opts:          CollectorOpts{AllTubes: true, TubeChecks: []string{"default:max_ready=1", "default:max_ready=2"}},
+			expectedError: "duplicate tube check: default:max_ready=2",
+		},
+		// We expect an error for a rule without a name.
+		{
+			opts:          CollectorOpts{Rules: []Rule{{Stat: "current-jobs-ready", Op: RuleAbove}}},
+			expectedError: "rule without a name",
+		},
+		// We expect an error for a duplicate rule.
+		{
+			opts: CollectorOpts{Rules: []Rule{
+				{Name: "backlog", Stat: "current-jobs-ready", Op: RuleAbove},
+				{Name: "backlog", Stat: "current-jobs-ready", Op: RuleAbove},
+			}},
+			expectedError: "duplicate rule: backlog",
+		},
+		// We expect an error for a rule without a stat.
+		{
+			opts:          CollectorOpts{Rules: []Rule{{Name: "backlog", Op: RuleAbove}}},
+			expectedError: "rule backlog without a stat",
+		},
+		// We expect an error for a rule of a tube that isn't scraped.
+		{
+			opts:          CollectorOpts{Tubes: []string{"default"}, Rules: []Rule{{Name: "backlog", Tube: "emails", Stat: "current-jobs-ready", Op: RuleAbove}}},
+			expectedError: "rule backlog of a tube that isn't scraped: emails",
+		},
+		// We expect an error for a rule with an unknown op.
+		{
+			opts:          CollectorOpts{Rules: []Rule{{Name: "backlog", Stat: "current-jobs-ready", Op: ">="}}},
+			expectedError: "rule backlog has an unknown op: >=",
+		},
+		// We expect an error for a rule that resolves beyond its threshold.
+		{
+			opts:          CollectorOpts{Rules: []Rule{{Name: "backlog", Stat: "current-jobs-ready", Op: RuleAbove, Threshold: 100, Resolve: &[]float64{110}[0]}}},
+			expectedError: "rule backlog resolve > threshold",
+		},
+		{
+			opts:          CollectorOpts{Rules: []Rule{{Name: "workers", Stat: "current-workers", Op: RuleBelow, Threshold: 2, Resolve: &[]float64{1}[0]}}},
+			expectedError: "rule workers resolve < threshold",
+		},
+		// We expect an error for a rule with a negative for duration.
+		{
+			opts:          CollectorOpts{Rules: []Rule{{Name: "backlog", Stat: "current-jobs-ready", Op: RuleAbove, For: -1}}},
+			expectedError: "rule backlog for < 0",
+		},
+		// We expect an error when the canary timeout is negative.
+		{
+			opts:          CollectorOpts{CanaryTimeout: -1},
+			expectedError: "canary timeout < 0",
+		},
+		// We expect an error when the tubes refresh interval is negative.
+		{
+			opts:          CollectorOpts{AllTubes: true, TubesRefreshInterval: -1},
+			expectedError: "tubes refresh interval < 0",
+		},
+		// We expect an error when the round-robin options are negative.
+		{
+			opts:          CollectorOpts{AllTubes: true, TubesPerScrape: -1},
+			expectedError: "tubes per scrape < 0",
+		},
+		{
+			opts:          CollectorOpts{AllTubes: true, TubesScrapeBudget: -1},
+			expectedError: "tubes scrape budget < 0",
+		},
+		// We expect an error when the polling options are negative.
+		{
+			opts:          CollectorOpts{PollInterval: -1},
+			expectedError: "poll interval < 0",
+		},
+		{
+			opts:          CollectorOpts{MaxStaleness: -1},
+			expectedError: "max staleness < 0",
+		},
+		// We expect an error when the scrape reuse window is negative.
+		{
+			opts:          CollectorOpts{ScrapeReuseWindow: -1},
+			expectedError: "scrape reuse window < 0",
+		},
+		// We expect an error when the min scrape interval is negative.
+		{
+			opts:          CollectorOpts{MinScrapeInterval: -1},
+			expectedError: "min scrape interval < 0",
+		},
+		// We expect an error when the failure policy is unknown.
+		{
+			opts:          CollectorOpts{FailurePolicy: "ignore"},
+			expectedError: "unknown failure policy: ignore",
+		},
+		// We expect an error when the stale grace period is negative.
+		{
+			opts:          CollectorOpts{StaleGracePeriod: -1},
+			expectedError: "stale grace period < 0",
+		},
+		// We expect an error when the max tracked tubes is negative.
+		{
+			opts:          CollectorOpts{AllTubes: true, MaxTrackedTubes: -1},
+			expectedError: "max tracked tubes < 0",
+		},
 	}
 
 	for _, tt := range tests {
@@ -188,12 +341,12 @@ func TestHealthyBeanstalkdServer(t *testing.T) {
 		{
 			allTubes:           false,
 			tubes:              []string{"anotherTube"},
-			expectedNumMetrics: 4, // 2 system metrics, 2 tube metrics (1 label)
+			expectedNumMetrics: 10, // 1 last success, 1 restarts, 2 system metrics, 2 tube metrics (1 label), 1 tube exists, 3 tube lifecycle
 		},
 		{
 			allTubes:           true,
 			tubes:              nil,
-			expectedNumMetrics: 6, // 2 system metrics, 4 tube metrics (2 + 2 labels)
+			expectedNumMetrics: 12, // 1 last success, 1 restarts, 2 system metrics, 4 tube metrics (2 + 2 labels), 4 tube lifecycle (2 labels)
 		},
 	}
 
@@ -221,16 +374,16 @@ func TestHealthyBeanstalkdServer(t *testing.T) {
 		}()
 
 		// "up" gauge
-		if expected, actual := 1., readGauge((<-ch).(prometheus.Gauge)); expected != actual {
+		if expected, actual := 1., readMetric(<-ch).GetGauge().GetValue(); expected != actual {
 			t.Errorf("expected 'up' value %v, actual %v", expected, actual)
 		}
 
 		// "total scrapes" counter
-		if expected, actual := 1., readCounter((<-ch).(prometheus.Counter)); expected != actual {
+		if expected, actual := 1., readMetric(<-ch).GetCounter().GetValue(); expected != actual {
 			t.Errorf("expected 'totalScrapes' value %v, actual %v", expected, actual)
 		}
 
-		// system metrics & tube metrics gauges
+		// last success, system metrics & tube metrics gauges
 		actualTotal := 0
 		for range ch {
 			actualTotal++
@@ -241,6 +394,46 @@ func TestHealthyBeanstalkdServer(t *testing.T) {
 	}
 }
 
+func TestTubeExists(t *testing.T) {
+	collector, err := NewBeanstalkdCollector(
+		mockHealthyBeanstalkd(),
+		CollectorOpts{
+			SystemMetrics: []string{"current_jobs_ready_count"},
+			Tubes:         []string{"default", "doesNotExist"},
+			TubeMetrics:   []string{"tube_current_jobs_ready_count"},
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		collector.resetMetrics()
+		collector.scrape()
+
+		if expected, actual := 1., readGauge(collector.tubeExists.WithLabelValues("default")); expected != actual {
+			t.Errorf("expected 'default' tube exists %v, actual %v", expected, actual)
+		}
+		if expected, actual := 0., readGauge(collector.tubeExists.WithLabelValues("doesNotExist")); expected != actual {
+			t.Errorf("expected 'doesNotExist' tube exists %v, actual %v", expected, actual)
+		}
+		if !collector.missingTubes["doesNotExist"] {
+			t.Error("expected 'doesNotExist' tube to be recorded as missing")
+		}
+	}
+}
+
+func TestTubeExistsNotExportedForAllTubes(t *testing.T) {
+	collector, err := NewBeanstalkdCollector(mockHealthyBeanstalkd(), CollectorOpts{AllTubes: true}, mockLogger())
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if collector.tubeExists != nil {
+		t.Error("expected no tube exists metric when collecting all tubes")
+	}
+}
+
 func TestGetTubesToScrape(t *testing.T) {
 	tests := []struct {
 		opts          CollectorOpts
@@ -283,6 +476,7 @@ func TestGetTubesToScrape(t *testing.T) {
 		collector := BeanstalkdCollector{
 			opts:       tt.opts,
 			beanstalkd: tt.beanstalkd,
+			now:        time.Now,
 		}
 		actualTubes, _ := collector.getTubesToScrape()
 		if !reflect.DeepEqual(tt.expectedTubes, actualTubes) {
@@ -291,6 +485,265 @@ func TestGetTubesToScrape(t *testing.T) {
 	}
 }
 
+func TestListTubesIsCached(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	beanstalkd := mockHealthyBeanstalkd()
+	collector, err := NewBeanstalkdCollector(
+		beanstalkd,
+		CollectorOpts{AllTubes: true, TubesRefreshInterval: time.Minute},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	collector.now = func() time.Time { return now }
+
+	tests := []struct {
+		num                        string
+		elapsed                    time.Duration
+		tubes                      []string
+		expectedTubes              []string
+		expectedListTubesCallCount int
+	}{
+		// We expect the first scrape to list the tubes.
+		{
+			num:                        "1) ",
+			elapsed:                    0,
+			tubes:                      []string{"default", "anotherTube"},
+			expectedTubes:              []string{"default", "anotherTube"},
+			expectedListTubesCallCount: 1,
+		},
+		// We expect the cached list within the refresh interval.
+		{
+			num:                        "2) ",
+			elapsed:                    30 * time.Second,
+			tubes:                      []string{"default"},
+			expectedTubes:              []string{"default", "anotherTube"},
+			expectedListTubesCallCount: 1,
+		},
+		// We expect the list to be refreshed after the refresh interval.
+		{
+			num:                        "3) ",
+			elapsed:                    time.Minute,
+			tubes:                      []string{"default"},
+			expectedTubes:              []string{"default"},
+			expectedListTubesCallCount: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		now = now.Add(tt.elapsed)
+		beanstalkd.listTubes = tt.tubes
+		actualTubes, err := collector.getTubesToScrape()
+		if err != nil {
+			t.Errorf(tt.num+"expected nil error, actual %v", err)
+		}
+		if !reflect.DeepEqual(tt.expectedTubes, actualTubes) {
+			t.Errorf(tt.num+"expected tubes %v, actual %v", tt.expectedTubes, actualTubes)
+		}
+		if tt.expectedListTubesCallCount != beanstalkd.listTubesCallCount {
+			t.Errorf(
+				tt.num+"expected ListTubes() to be called %v times, actual %v",
+				tt.expectedListTubesCallCount,
+				beanstalkd.listTubesCallCount,
+			)
+		}
+	}
+}
+
+func TestScrapeOnlyListsTubesOnce(t *testing.T) {
+	beanstalkd := mockHealthyBeanstalkd()
+	collector, err := NewBeanstalkdCollector(beanstalkd, CollectorOpts{AllTubes: true}, mockLogger())
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	collector.scrape()
+	if expected, actual := 1, beanstalkd.listTubesCallCount; expected != actual {
+		t.Errorf("expected ListTubes() to be called %v times, actual %v", expected, actual)
+	}
+}
+
+func TestDeletedTubeRefreshesCachedList(t *testing.T) {
+	beanstalkd := mockHealthyBeanstalkd()
+	beanstalkd.listTubes = []string{"default", "anotherTube", "deletedTube"}
+	collector, err := NewBeanstalkdCollector(
+		beanstalkd,
+		CollectorOpts{AllTubes: true, TubesRefreshInterval: time.Hour},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	collector.scrape()
+	if collector.tubeList != nil {
+		t.Errorf("expected the cached tubes to be cleared, actual %v", collector.tubeList)
+	}
+	collector.scrape()
+	if expected, actual := 2, beanstalkd.listTubesCallCount; expected != actual {
+		t.Errorf("expected ListTubes() to be called %v times, actual %v", expected, actual)
+	}
+}
+
+func TestConcurrentCollectsShareScrape(t *testing.T) {
+	server := mockHealthyBeanstalkd()
+	release := make(chan struct{})
+	server.statsHook = func() {
+		<-release
+	}
+	collector, err := NewBeanstalkdCollector(server, CollectorOpts{}, mockLogger())
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			collectAll(collector)
+		}()
+	}
+	// Give the collects time to start waiting.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if expected, actual := 1., readCounter(collector.totalScrapes); expected != actual {
+		t.Errorf("expected %v scrapes, actual %v", expected, actual)
+	}
+}
+
+func TestScrapeReuseWindow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	collector, err := NewBeanstalkdCollector(
+		mockHealthyBeanstalkd(),
+		CollectorOpts{ScrapeReuseWindow: time.Second},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	collector.now = func() time.Time { return now }
+
+	tests := []struct {
+		elapsed        time.Duration
+		expectedScrape float64
+	}{
+		// We expect the first collect to scrape.
+		{elapsed: 0, expectedScrape: 1},
+		// We expect a recent scrape to be reused.
+		{elapsed: 500 * time.Millisecond, expectedScrape: 1},
+		// We expect a new scrape after the reuse window.
+		{elapsed: 500 * time.Millisecond, expectedScrape: 2},
+	}
+
+	for _, tt := range tests {
+		now = now.Add(tt.elapsed)
+		metrics := collectAll(collector)
+		if expected, actual := 1., readMetric(metrics[0]).GetGauge().GetValue(); expected != actual {
+			t.Errorf("expected 'up' value %v, actual %v", expected, actual)
+		}
+		if actual := readCounter(collector.totalScrapes); tt.expectedScrape != actual {
+			t.Errorf("expected %v scrapes, actual %v", tt.expectedScrape, actual)
+		}
+	}
+}
+
+func TestMinScrapeInterval(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	collector, err := NewBeanstalkdCollector(
+		mockHealthyBeanstalkd(),
+		CollectorOpts{MinScrapeInterval: 5 * time.Second},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	collector.now = func() time.Time { return now }
+
+	tests := []struct {
+		elapsed           time.Duration
+		expectedScrapes   float64
+		expectedThrottled float64
+	}{
+		// We expect the first collect to scrape.
+		{elapsed: 0, expectedScrapes: 1, expectedThrottled: 0},
+		// We expect collects within the interval to be throttled.
+		{elapsed: time.Second, expectedScrapes: 1, expectedThrottled: 1},
+		{elapsed: 3 * time.Second, expectedScrapes: 1, expectedThrottled: 2},
+		// We expect a new scrape after the interval.
+		{elapsed: time.Second, expectedScrapes: 2, expectedThrottled: 2},
+	}
+
+	for _, tt := range tests {
+		now = now.Add(tt.elapsed)
+		metrics := collectAll(collector)
+		if actual := readCounter(collector.totalScrapes); tt.expectedScrapes != actual {
+			t.Errorf("expected %v scrapes, actual %v", tt.expectedScrapes, actual)
+		}
+		// The throttled scrapes counter is the last metric.
+		if actual := readMetric(metrics[len(metrics)-1]).GetCounter().GetValue(); tt.expectedThrottled != actual {
+			t.Errorf("expected %v throttled scrapes, actual %v", tt.expectedThrottled, actual)
+		}
+	}
+}
+
+func TestFailurePolicy(t *testing.T) {
+	tests := []struct {
+		num                string
+		policy             string
+		elapsed            time.Duration
+		expectedNumMetrics int
+	}{
+		// We expect the system and tube metrics to be dropped.
+		{num: "1) ", policy: FailurePolicyDrop, elapsed: time.Second, expectedNumMetrics: 7},
+		// We expect the system and tube metrics to be kept during the grace period.
+		{num: "2) ", policy: FailurePolicyKeep, elapsed: time.Minute, expectedNumMetrics: 10},
+		// We expect the system and tube metrics to be dropped after the grace period.
+		{num: "3) ", policy: FailurePolicyKeep, elapsed: time.Minute + time.Second, expectedNumMetrics: 7},
+	}
+
+	for _, tt := range tests {
+		now := time.Unix(1700000000, 0)
+		server := mockHealthyBeanstalkd()
+		collector, err := NewBeanstalkdCollector(
+			server,
+			CollectorOpts{
+				SystemMetrics:    []string{"current_jobs_urgent_count", "current_jobs_ready_count"},
+				Tubes:            []string{"default"},
+				TubeMetrics:      []string{"tube_current_jobs_ready_count"},
+				FailurePolicy:    tt.policy,
+				StaleGracePeriod: time.Minute,
+			},
+			mockLogger(),
+		)
+		if err != nil {
+			t.Fatalf("expected nil error, actual %v", err)
+		}
+		collector.now = func() time.Time { return now }
+
+		// up, total scrapes, last success, 2 system metrics, 1 restarts,
+		// 1 tube metric, 1 tube exists and 3 tube lifecycle. After a failed
+		// scrape, the 3 system and tube metrics, and tube exists, may be dropped.
+		if expected, actual := 11, len(collectAll(collector)); expected != actual {
+			t.Errorf(tt.num+"expected %v metrics, actual %v", expected, actual)
+		}
+
+		now = now.Add(tt.elapsed)
+		server.statsError = fmt.Errorf("stats error")
+		metrics := collectAll(collector)
+		if expected, actual := 0., readMetric(metrics[0]).GetGauge().GetValue(); expected != actual {
+			t.Errorf(tt.num+"expected 'up' value %v, actual %v", expected, actual)
+		}
+		if tt.expectedNumMetrics != len(metrics) {
+			t.Errorf(tt.num+"expected %v metrics, actual %v", tt.expectedNumMetrics, len(metrics))
+		}
+		if expected, actual := 1700000000., readGauge(collector.lastSuccessfulScrape); expected != actual {
+			t.Errorf(tt.num+"expected last successful scrape %v, actual %v", expected, actual)
+		}
+	}
+}
+
 /********************     MOCKS     ********************/
 
 type mockBeanstalkdServer struct {
@@ -300,20 +753,38 @@ type mockBeanstalkdServer struct {
 	tubesStatsError error
 	listTubes       []string
 	listTubesError  error
+
+	listTubesCallCount int
+	fetchedTubes       [][]string
+	statsHook          func()
 }
 
 func (m *mockBeanstalkdServer) ListTubes() ([]string, error) {
+	m.listTubesCallCount++
 	return m.listTubes, m.listTubesError
 }
 
 func (m *mockBeanstalkdServer) FetchStats() (beanstalkd.ServerStats, error) {
+	if m.statsHook != nil {
+		m.statsHook()
+	}
 	return m.stats, m.statsError
 }
 
 func (m *mockBeanstalkdServer) FetchTubesStats(tubes map[string]bool) (beanstalkd.ManyTubeStats, error) {
+	fetched := make([]string, 0, len(tubes))
+	for tubeName := range tubes {
+		fetched = append(fetched, tubeName)
+	}
+	sort.Strings(fetched)
+	m.fetchedTubes = append(m.fetchedTubes, fetched)
+
 	tubesStats := make(beanstalkd.ManyTubeStats, len(tubes))
 	for tubeName := range tubes {
-		tubesStats[tubeName] = m.tubesStats[tubeName]
+		// Like beanstalkd, tubes that don't exist are skipped.
+		if statsOrErr, ok := m.tubesStats[tubeName]; ok {
+			tubesStats[tubeName] = statsOrErr
+		}
 	}
 	return tubesStats, m.tubesStatsError
 }
@@ -355,6 +826,8 @@ func mockUnhealthyBeanstalkd() *mockBeanstalkdServer {
 	}
 }
 
+var errUnexpected = fmt.Errorf("unexpected call")
+
 func mockLogger() *slog.Logger {
 	var buff bytes.Buffer
 	logger := slog.New(slog.NewTextHandler(&buff, nil))
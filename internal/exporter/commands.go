@@ -0,0 +1,33 @@
+package exporter
+
+import (
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// commandObserverSetter is implemented by a BeanstalkdServer that
+// can report how long each command sent to beanstalkd took.
+type commandObserverSetter interface {
+	SetCommandObserver(observer beanstalkd.CommandObserver)
+}
+
+func newCommandDuration() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "command_duration_seconds",
+		Help:      "The round trip time of the commands sent to beanstalkd by the exporter, by command.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command"})
+}
+
+// ObserveCommand observes how long a command sent to beanstalkd took.
+// It can be the CommandObserver of other servers, so that all of the
+// commands the exporter sends are observed.
+func (b *BeanstalkdCollector) ObserveCommand(command string, duration time.Duration) {
+	if b.commandDuration == nil {
+		return
+	}
+	b.commandDuration.WithLabelValues(command).Observe(duration.Seconds())
+}
@@ -0,0 +1,62 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+func TestCommandDuration(t *testing.T) {
+	server := &mockCommandObserverSetter{
+		mockBeanstalkdServer: *mockHealthyBeanstalkd(),
+	}
+	collector, err := NewBeanstalkdCollector(server, CollectorOpts{}, mockLogger())
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if collector.commandDuration == nil || server.observer == nil {
+		t.Fatal("expected the commands to be observed")
+	}
+
+	server.observer("stats", 10*time.Millisecond)
+	server.observer("stats", 30*time.Millisecond)
+	server.observer("list-tubes", 5*time.Millisecond)
+
+	histograms := collectAll(collector.commandDuration)
+	if expected, actual := 2, len(histograms); expected != actual {
+		t.Fatalf("expected %v histograms, actual %v", expected, actual)
+	}
+	for _, m := range histograms {
+		pb := readMetric(m)
+		if pb.GetLabel()[0].GetValue() != "stats" {
+			continue
+		}
+		if expected, actual := uint64(2), pb.GetHistogram().GetSampleCount(); expected != actual {
+			t.Errorf("expected %v stats commands, actual %v", expected, actual)
+		}
+	}
+}
+
+func TestNoCommandDuration(t *testing.T) {
+	collector, err := NewBeanstalkdCollector(mockHealthyBeanstalkd(), CollectorOpts{}, mockLogger())
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if collector.commandDuration != nil {
+		t.Error("expected no command durations")
+	}
+	// We expect observing commands to do nothing.
+	collector.ObserveCommand("stats", time.Millisecond)
+}
+
+/********************     MOCKS     ********************/
+
+type mockCommandObserverSetter struct {
+	mockBeanstalkdServer
+	observer beanstalkd.CommandObserver
+}
+
+func (m *mockCommandObserverSetter) SetCommandObserver(observer beanstalkd.CommandObserver) {
+	m.observer = observer
+}
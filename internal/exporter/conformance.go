@@ -0,0 +1,180 @@
+package exporter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The checks of a tube's conformance to what's expected of it.
+const (
+	// checkExists expects the tube to exist.
+	checkExists = "exists"
+	// checkNotPaused expects the tube not to be paused.
+	checkNotPaused = "not_paused"
+	// checkMinWatchers expects at least a number of connections watching the tube.
+	checkMinWatchers = "min_watchers"
+	// checkMaxReady expects at most a number of ready jobs in the tube.
+	checkMaxReady = "max_ready"
+)
+
+// conformanceCheck is a check of a tube, declared as "tube:check"
+// or "tube:check=limit".
+type conformanceCheck struct {
+	tube  string
+	check string
+	limit int64
+}
+
+// parseConformanceCheck parses the declaration of a check of a tube.
+func parseConformanceCheck(declaration string) (c conformanceCheck, err error) {
+	i := strings.LastIndex(declaration, ":")
+	if i < 1 {
+		err = fmt.Errorf("invalid tube check: %v", declaration)
+		return
+	}
+	c.tube = declaration[:i]
+	c.check = declaration[i+1:]
+
+	limit := ""
+	if j := strings.Index(c.check, "="); j >= 0 {
+		c.check, limit = c.check[:j], c.check[j+1:]
+	}
+	switch c.check {
+	case checkExists, checkNotPaused:
+		if limit != "" {
+			err = fmt.Errorf("tube check %v doesn't take a limit: %v", c.check, declaration)
+		}
+	case checkMinWatchers, checkMaxReady:
+		c.limit, err = strconv.ParseInt(limit, 10, 64)
+		if err != nil || c.limit < 0 {
+			err = fmt.Errorf("tube check %v needs a limit >= 0: %v", c.check, declaration)
+		}
+	default:
+		err = fmt.Errorf("unknown tube check: %v", declaration)
+	}
+	return
+}
+
+// ConformanceResult is the result of a check of a tube, from the most
+// recent scrape. The limit is nil for the checks without one.
+type ConformanceResult struct {
+	Tube       string
+	Check      string
+	Limit      *int64
+	Conforming bool
+}
+
+// conformanceChecker checks the tubes against what's expected of them
+// on each scrape, so that the expectations between the producers and
+// the consumers of a tube can be validated continuously.
+type conformanceChecker struct {
+	checks []conformanceCheck
+
+	mutex   sync.RWMutex
+	results []ConformanceResult
+
+	conformance *prometheus.GaugeVec
+}
+
+func newConformanceChecker(checks []conformanceCheck) *conformanceChecker {
+	sorted := make([]conformanceCheck, len(checks))
+	copy(sorted, checks)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].tube != sorted[j].tube {
+			return sorted[i].tube < sorted[j].tube
+		}
+		return sorted[i].check < sorted[j].check
+	})
+	return &conformanceChecker{
+		checks: sorted,
+		conformance: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_conformance",
+			Help:      "Whether the tube conforms to the check (1 = conforming, 0 = not conforming).",
+		}, []string{"tube", "check"}),
+	}
+}
+
+// observe checks the most recent stats of the tubes, replacing the
+// results of previous scrapes. A tube without stats doesn't exist,
+// so it has no watchers and no ready jobs, and isn't paused. A pending
+// tube (one that hasn't been fetched yet, when the tubes are scraped
+// round-robin) keeps the results of its previous checks, and has none
+// until it's fetched.
+func (c *conformanceChecker) observe(tubeStats map[string]cachedTubeStats, pending map[string]bool) {
+	c.mutex.RLock()
+	previous := make(map[[2]string]ConformanceResult, len(c.results))
+	for _, result := range c.results {
+		previous[[2]string{result.Tube, result.Check}] = result
+	}
+	c.mutex.RUnlock()
+
+	results := make([]ConformanceResult, 0, len(c.checks))
+	for _, check := range c.checks {
+		if pending[check.tube] {
+			if result, ok := previous[[2]string{check.tube, check.check}]; ok {
+				results = append(results, result)
+			}
+			continue
+		}
+		cached, exists := tubeStats[check.tube]
+		stat := func(name string) int64 {
+			v, _ := strconv.ParseInt(cached.stats[name], 10, 64)
+			return v
+		}
+
+		var conforming bool
+		switch check.check {
+		case checkExists:
+			conforming = exists
+		case checkNotPaused:
+			conforming = stat("pause-time-left") == 0
+		case checkMinWatchers:
+			conforming = stat("current-watching") >= check.limit
+		case checkMaxReady:
+			conforming = stat("current-jobs-ready") <= check.limit
+		}
+		c.conformance.WithLabelValues(check.tube, check.check).Set(boolToFloat(conforming))
+		result := ConformanceResult{
+			Tube:       check.tube,
+			Check:      check.check,
+			Conforming: conforming,
+		}
+		if check.check == checkMinWatchers || check.check == checkMaxReady {
+			limit := check.limit
+			result.Limit = &limit
+		}
+		results = append(results, result)
+	}
+
+	c.mutex.Lock()
+	c.results = results
+	c.mutex.Unlock()
+}
+
+func (c *conformanceChecker) describe(ch chan<- *prometheus.Desc) {
+	c.conformance.Describe(ch)
+}
+
+func (c *conformanceChecker) collect(ch chan<- prometheus.Metric) {
+	c.conformance.Collect(ch)
+}
+
+// Conformance returns the results of the tube checks from the most
+// recent scrape, sorted by tube and check. There are no results
+// before the first scrape, or when there are no tube checks.
+func (b *BeanstalkdCollector) Conformance() []ConformanceResult {
+	if b.conformance == nil {
+		return nil
+	}
+	b.conformance.mutex.RLock()
+	defer b.conformance.mutex.RUnlock()
+	results := make([]ConformanceResult, len(b.conformance.results))
+	copy(results, b.conformance.results)
+	return results
+}
@@ -0,0 +1,153 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+func TestParseConformanceCheck(t *testing.T) {
+	tests := []struct {
+		num           string
+		declaration   string
+		expected      conformanceCheck
+		expectedError string
+	}{
+		{num: "1) ", declaration: "default:exists", expected: conformanceCheck{tube: "default", check: "exists"}},
+		{num: "2) ", declaration: "default:not_paused", expected: conformanceCheck{tube: "default", check: "not_paused"}},
+		{num: "3) ", declaration: "default:min_watchers=2", expected: conformanceCheck{tube: "default", check: "min_watchers", limit: 2}},
+		{num: "4) ", declaration: "default:max_ready=10000", expected: conformanceCheck{tube: "default", check: "max_ready", limit: 10000}},
+		{num: "5) ", declaration: "exists", expectedError: "invalid tube check: exists"},
+		{num: "6) ", declaration: "default:exists=1", expectedError: "tube check exists doesn't take a limit: default:exists=1"},
+		{num: "7) ", declaration: "default:min_watchers", expectedError: "tube check min_watchers needs a limit >= 0: default:min_watchers"},
+		{num: "8) ", declaration: "default:max_ready=-1", expectedError: "tube check max_ready needs a limit >= 0: default:max_ready=-1"},
+		{num: "9) ", declaration: "default:empty", expectedError: "unknown tube check: default:empty"},
+	}
+	for _, tt := range tests {
+		actual, err := parseConformanceCheck(tt.declaration)
+		if tt.expectedError != "" {
+			if err == nil || err.Error() != tt.expectedError {
+				t.Errorf(tt.num+"expected error %v, actual %v", tt.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf(tt.num+"expected nil error, actual %v", err)
+		}
+		if !reflect.DeepEqual(tt.expected, actual) {
+			t.Errorf(tt.num+"expected %v, actual %v", tt.expected, actual)
+		}
+	}
+}
+
+func TestConformanceChecker(t *testing.T) {
+	collector, err := NewBeanstalkdCollector(
+		mockHealthyBeanstalkd(),
+		CollectorOpts{
+			AllTubes: true,
+			TubeChecks: []string{
+				"default:exists",
+				"default:not_paused",
+				"default:min_watchers=2",
+				"default:max_ready=100",
+				"missingTube:exists",
+				"missingTube:max_ready=0",
+			},
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+
+	// We expect no results before the first scrape.
+	if actual := collector.Conformance(); len(actual) != 0 {
+		t.Errorf("expected no results, actual %v", actual)
+	}
+
+	collector.conformance.observe(map[string]cachedTubeStats{
+		"default": {stats: beanstalkd.TubeStats{
+			"pause-time-left":    "30",
+			"current-watching":   "2",
+			"current-jobs-ready": "101",
+		}},
+	}, nil)
+
+	limit := func(v int64) *int64 { return &v }
+	expected := []ConformanceResult{
+		{Tube: "default", Check: "exists", Conforming: true},
+		{Tube: "default", Check: "max_ready", Limit: limit(100), Conforming: false},
+		{Tube: "default", Check: "min_watchers", Limit: limit(2), Conforming: true},
+		{Tube: "default", Check: "not_paused", Conforming: false},
+		{Tube: "missingTube", Check: "exists", Conforming: false},
+		{Tube: "missingTube", Check: "max_ready", Limit: limit(0), Conforming: true},
+	}
+	if actual := collector.Conformance(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+	for _, result := range expected {
+		expectedValue := boolToFloat(result.Conforming)
+		actual := readGauge(collector.conformance.conformance.WithLabelValues(result.Tube, result.Check))
+		if expectedValue != actual {
+			t.Errorf("expected %v %v %v, actual %v", result.Tube, result.Check, expectedValue, actual)
+		}
+	}
+}
+
+func TestConformanceCheckerRoundRobin(t *testing.T) {
+	collector, err := NewBeanstalkdCollector(
+		mockHealthyBeanstalkd(),
+		CollectorOpts{
+			AllTubes:       true,
+			TubesPerScrape: 1,
+			TubeChecks: []string{
+				"anotherTube:exists",
+				"default:exists",
+				"missingTube:exists",
+			},
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+
+	// We expect a tube that hasn't been fetched yet to have no
+	// results, rather than to be missing, and to keep its results
+	// while the other tubes are fetched.
+	tests := []struct {
+		num      string
+		expected []ConformanceResult
+	}{
+		{
+			num: "1) ",
+			expected: []ConformanceResult{
+				{Tube: "anotherTube", Check: "exists", Conforming: true},
+				{Tube: "missingTube", Check: "exists", Conforming: false},
+			},
+		},
+		{
+			num: "2) ",
+			expected: []ConformanceResult{
+				{Tube: "anotherTube", Check: "exists", Conforming: true},
+				{Tube: "default", Check: "exists", Conforming: true},
+				{Tube: "missingTube", Check: "exists", Conforming: false},
+			},
+		},
+		{
+			num: "3) ",
+			expected: []ConformanceResult{
+				{Tube: "anotherTube", Check: "exists", Conforming: true},
+				{Tube: "default", Check: "exists", Conforming: true},
+				{Tube: "missingTube", Check: "exists", Conforming: false},
+			},
+		},
+	}
+	for _, tt := range tests {
+		collector.scrape()
+		if actual := collector.Conformance(); !reflect.DeepEqual(tt.expected, actual) {
+			t.Errorf(tt.num+"expected %v, actual %v", tt.expected, actual)
+		}
+	}
+}
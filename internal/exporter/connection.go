@@ -0,0 +1,69 @@
+package exporter
+
+import (
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// connectionStatser is implemented by a BeanstalkdServer that
+// reports on its connection to beanstalkd.
+type connectionStatser interface {
+	ConnectionStats() beanstalkd.ConnectionStats
+}
+
+// connectionMetrics are the metrics about the connection to beanstalkd.
+type connectionMetrics struct {
+	server connectionStatser
+
+	retries       *prometheus.Desc
+	breakerState  *prometheus.Desc
+	breakerTrips  *prometheus.Desc
+	activeAddress *prometheus.Desc
+}
+
+func newConnectionMetrics(server connectionStatser) *connectionMetrics {
+	return &connectionMetrics{
+		server: server,
+		retries: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "connection_retries_total"),
+			"The cumulative number of commands retried after reconnecting to beanstalkd.",
+			nil, nil,
+		),
+		breakerState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "circuit_breaker_state"),
+			"The state of the circuit breaker (0 = closed, 1 = open, 2 = half-open).",
+			nil, nil,
+		),
+		breakerTrips: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "circuit_breaker_trips_total"),
+			"The cumulative number of times the circuit breaker opened.",
+			nil, nil,
+		),
+		activeAddress: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "active_address"),
+			"Whether this is the address of beanstalkd that most recently answered (1 = active, 0 = not active).",
+			[]string{"address"}, nil,
+		),
+	}
+}
+
+func (c *connectionMetrics) describe(ch chan<- *prometheus.Desc) {
+	ch <- c.retries
+	ch <- c.breakerState
+	ch <- c.breakerTrips
+	ch <- c.activeAddress
+}
+
+func (c *connectionMetrics) collect(ch chan<- prometheus.Metric) {
+	stats := c.server.ConnectionStats()
+	ch <- prometheus.MustNewConstMetric(c.retries, prometheus.CounterValue, float64(stats.Retries))
+	ch <- prometheus.MustNewConstMetric(c.breakerState, prometheus.GaugeValue, float64(stats.BreakerState))
+	ch <- prometheus.MustNewConstMetric(c.breakerTrips, prometheus.CounterValue, float64(stats.BreakerTrips))
+	for _, address := range stats.Addresses {
+		active := 0.
+		if address == stats.ActiveAddress {
+			active = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.activeAddress, prometheus.GaugeValue, active, address)
+	}
+}
@@ -0,0 +1,66 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+func TestConnectionMetrics(t *testing.T) {
+	server := &mockConnectionStatser{
+		stats: beanstalkd.ConnectionStats{
+			Retries:       3,
+			BreakerState:  beanstalkd.BreakerOpen,
+			BreakerTrips:  1,
+			Addresses:     []string{"active:11300", "standby:11300"},
+			ActiveAddress: "standby:11300",
+		},
+	}
+	collector, err := NewBeanstalkdCollector(server, CollectorOpts{}, mockLogger())
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if collector.connectionMetrics == nil {
+		t.Fatal("expected connection metrics")
+	}
+
+	metrics := collectAll(collector)
+	// The connection metrics are the last metrics.
+	metrics = metrics[len(metrics)-5:]
+	if expected, actual := 3., readMetric(metrics[0]).GetCounter().GetValue(); expected != actual {
+		t.Errorf("expected %v retries, actual %v", expected, actual)
+	}
+	if expected, actual := 1., readMetric(metrics[1]).GetGauge().GetValue(); expected != actual {
+		t.Errorf("expected breaker state %v, actual %v", expected, actual)
+	}
+	if expected, actual := 1., readMetric(metrics[2]).GetCounter().GetValue(); expected != actual {
+		t.Errorf("expected %v breaker trips, actual %v", expected, actual)
+	}
+	if expected, actual := 0., readMetric(metrics[3]).GetGauge().GetValue(); expected != actual {
+		t.Errorf("expected 'active:11300' active address %v, actual %v", expected, actual)
+	}
+	if expected, actual := 1., readMetric(metrics[4]).GetGauge().GetValue(); expected != actual {
+		t.Errorf("expected 'standby:11300' active address %v, actual %v", expected, actual)
+	}
+}
+
+func TestNoConnectionMetrics(t *testing.T) {
+	collector, err := NewBeanstalkdCollector(mockHealthyBeanstalkd(), CollectorOpts{}, mockLogger())
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if collector.connectionMetrics != nil {
+		t.Error("expected no connection metrics")
+	}
+}
+
+/********************     MOCKS     ********************/
+
+type mockConnectionStatser struct {
+	mockBeanstalkdServer
+	stats beanstalkd.ConnectionStats
+}
+
+func (m *mockConnectionStatser) ConnectionStats() beanstalkd.ConnectionStats {
+	return m.stats
+}
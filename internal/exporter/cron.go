@@ -0,0 +1,100 @@
+package exporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a cron-like schedule of minutes, with the fields
+// "minute hour day-of-month month day-of-week". Each field is "*",
+// or a list of values and ranges, each with an optional "/step".
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+
+	// anyDay and anyWeekday are true when the field is "*". Like
+	// cron, when both are restricted either of them can match.
+	anyDay, anyWeekday bool
+}
+
+// parseCronSchedule parses a cron-like schedule, like "0 2 * * 1-5".
+func parseCronSchedule(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule, expected 5 fields: %v", spec)
+	}
+	s := &cronSchedule{
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}
+	var err error
+	for i, field := range []struct {
+		values   *map[int]bool
+		min, max int
+	}{
+		{&s.minutes, 0, 59},
+		{&s.hours, 0, 23},
+		{&s.days, 1, 31},
+		{&s.months, 1, 12},
+		{&s.weekdays, 0, 7},
+	} {
+		if *field.values, err = parseCronField(fields[i], field.min, field.max); err != nil {
+			return nil, fmt.Errorf("invalid schedule %v: %v", spec, err)
+		}
+	}
+	// Sunday is both 0 and 7.
+	if s.weekdays[7] {
+		s.weekdays[0] = true
+	}
+	return s, nil
+}
+
+// parseCronField parses a field of a schedule into its values.
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step: %v", part)
+			}
+			step, part = n, part[:i]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value: %v", part)
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value: %v", part)
+				}
+			}
+			if from < min || to > max || from > to {
+				return nil, fmt.Errorf("value out of range %v-%v: %v", min, max, part)
+			}
+		}
+		for v := from; v <= to; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// matches returns true when the schedule includes the minute of t.
+func (s *cronSchedule) matches(t time.Time) bool {
+	if !s.minutes[t.Minute()] || !s.hours[t.Hour()] || !s.months[int(t.Month())] {
+		return false
+	}
+	day, weekday := s.days[t.Day()], s.weekdays[int(t.Weekday())]
+	if !s.anyDay && !s.anyWeekday {
+		return day || weekday
+	}
+	return day && weekday
+}
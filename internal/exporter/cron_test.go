@@ -0,0 +1,68 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronSchedule(t *testing.T) {
+	// 2024-03-01 was a Friday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		num      string
+		spec     string
+		at       time.Time
+		expected bool
+	}{
+		{num: "1) ", spec: "* * * * *", at: at(1, 12, 34), expected: true},
+		{num: "2) ", spec: "0 2 * * *", at: at(1, 2, 0), expected: true},
+		{num: "3) ", spec: "0 2 * * *", at: at(1, 2, 1), expected: false},
+		{num: "4) ", spec: "*/15 * * * *", at: at(1, 9, 45), expected: true},
+		{num: "5) ", spec: "*/15 * * * *", at: at(1, 9, 50), expected: false},
+		{num: "6) ", spec: "0 9-17/4 * * *", at: at(1, 13, 0), expected: true},
+		{num: "7) ", spec: "0 9-17/4 * * *", at: at(1, 15, 0), expected: false},
+		{num: "8) ", spec: "30 1 * * 1-5", at: at(1, 1, 30), expected: true},
+		{num: "9) ", spec: "30 1 * * 1-5", at: at(2, 1, 30), expected: false},
+		// We expect Sunday to be both 0 and 7.
+		{num: "10) ", spec: "30 1 * * 7", at: at(3, 1, 30), expected: true},
+		{num: "11) ", spec: "0 0 1,15 * *", at: at(15, 0, 0), expected: true},
+		{num: "12) ", spec: "0 0 * 1 *", at: at(1, 0, 0), expected: false},
+		// We expect either the day of the month or the day of the week to match, when both are restricted.
+		{num: "13) ", spec: "0 0 1 * 0", at: at(1, 0, 0), expected: true},
+		{num: "14) ", spec: "0 0 1 * 0", at: at(3, 0, 0), expected: true},
+		{num: "15) ", spec: "0 0 1 * 0", at: at(2, 0, 0), expected: false},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCronSchedule(tt.spec)
+		if err != nil {
+			t.Errorf(tt.num+"expected nil error, actual %v", err)
+			continue
+		}
+		if actual := schedule.matches(tt.at); tt.expected != actual {
+			t.Errorf(tt.num+"expected %v, actual %v", tt.expected, actual)
+		}
+	}
+}
+
+func TestCronScheduleErrors(t *testing.T) {
+	tests := []struct {
+		num           string
+		spec          string
+		expectedError string
+	}{
+		{num: "1) ", spec: "0 2 * *", expectedError: "invalid schedule, expected 5 fields: 0 2 * *"},
+		{num: "2) ", spec: "60 * * * *", expectedError: "invalid schedule 60 * * * *: value out of range 0-59: 60"},
+		{num: "3) ", spec: "* * 0 * *", expectedError: "invalid schedule * * 0 * *: value out of range 1-31: 0"},
+		{num: "4) ", spec: "* 5-1 * * *", expectedError: "invalid schedule * 5-1 * * *: value out of range 0-23: 5-1"},
+		{num: "5) ", spec: "*/0 * * * *", expectedError: "invalid schedule */0 * * * *: invalid step: */0"},
+		{num: "6) ", spec: "a * * * *", expectedError: "invalid schedule a * * * *: invalid value: a"},
+	}
+	for _, tt := range tests {
+		_, err := parseCronSchedule(tt.spec)
+		if err == nil || err.Error() != tt.expectedError {
+			t.Errorf(tt.num+"expected error %v, actual %v", tt.expectedError, err)
+		}
+	}
+}
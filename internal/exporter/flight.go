@@ -0,0 +1,35 @@
+package exporter
+
+import (
+	"sync"
+)
+
+// flight makes sure that concurrent callers share a single call
+// of a function, rather than each calling it in turn.
+type flight struct {
+	mutex sync.Mutex
+	done  chan struct{}
+}
+
+// do calls fn, unless fn is already being called, in which case
+// it waits for that call to finish instead.
+func (f *flight) do(fn func()) {
+	f.mutex.Lock()
+	if f.done != nil {
+		done := f.done
+		f.mutex.Unlock()
+		<-done
+		return
+	}
+	done := make(chan struct{})
+	f.done = done
+	f.mutex.Unlock()
+
+	defer func() {
+		f.mutex.Lock()
+		f.done = nil
+		f.mutex.Unlock()
+		close(done)
+	}()
+	fn()
+}
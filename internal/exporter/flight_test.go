@@ -0,0 +1,66 @@
+package exporter
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFlightSharesConcurrentCalls(t *testing.T) {
+	var f flight
+	var calls int32
+	var released atomic.Bool
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		f.do(func() {
+			atomic.AddInt32(&calls, 1)
+			close(started)
+			<-release
+		})
+	}()
+	<-started
+
+	// The first call isn't released until the other callers have started.
+	var waiting sync.WaitGroup
+	waiting.Add(5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			waiting.Done()
+			called := false
+			f.do(func() {
+				atomic.AddInt32(&calls, 1)
+				called = true
+			})
+			// We expect a caller that didn't call fn to have
+			// waited for the first call to finish.
+			if !called && !released.Load() {
+				t.Error("expected to wait for the first call")
+			}
+		}()
+	}
+	waiting.Wait()
+
+	// We expect no other call while the first call is in progress.
+	if expected, actual := int32(1), atomic.LoadInt32(&calls); expected != actual {
+		t.Errorf("expected %v call, actual %v", expected, actual)
+	}
+	released.Store(true)
+	close(release)
+	wg.Wait()
+
+	// We expect a new call once the previous call finished.
+	before := atomic.LoadInt32(&calls)
+	f.do(func() {
+		atomic.AddInt32(&calls, 1)
+	})
+	if expected, actual := before+1, atomic.LoadInt32(&calls); expected != actual {
+		t.Errorf("expected %v calls, actual %v", expected, actual)
+	}
+}
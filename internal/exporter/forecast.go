@@ -0,0 +1,136 @@
+package exporter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultForecastWindow = 15 * time.Minute
+
+	// minForecastSamples is the fewest samples in the window
+	// for which a tube's ready jobs are forecast.
+	minForecastSamples = 3
+)
+
+// forecastSample is a tube's ready jobs in a scrape.
+type forecastSample struct {
+	at    time.Time
+	ready float64
+}
+
+// backlogForecaster fits a line to each tube's ready jobs over a sliding
+// window of scrapes, to forecast when the ready jobs reach a threshold.
+type backlogForecaster struct {
+	threshold float64
+	window    time.Duration
+	samples   map[string][]forecastSample
+
+	slope              *prometheus.GaugeVec
+	secondsToThreshold *prometheus.GaugeVec
+}
+
+func newBacklogForecaster(threshold int, window time.Duration) *backlogForecaster {
+	return &backlogForecaster{
+		threshold: float64(threshold),
+		window:    window,
+		samples:   make(map[string][]forecastSample),
+		slope: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_forecast_ready_jobs_per_second",
+			Help:      "The trend of the ready jobs for this tube, fitted over the forecast window.",
+		}, []string{"tube"}),
+		secondsToThreshold: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_forecast_seconds_to_threshold",
+			Help:      "The forecast number of seconds until the ready jobs for this tube reach the forecast threshold.",
+		}, []string{"tube"}),
+	}
+}
+
+// observe adds the stats of the tubes fetched since the previous scrape
+// to the window, and forecasts the tubes, replacing the metrics of
+// previous scrapes. There's no forecast for a tube without enough
+// samples, or whose ready jobs aren't growing.
+func (f *backlogForecaster) observe(tubeStats map[string]cachedTubeStats) {
+	f.slope.Reset()
+	f.secondsToThreshold.Reset()
+	for tube := range f.samples {
+		if _, ok := tubeStats[tube]; !ok {
+			delete(f.samples, tube)
+		}
+	}
+
+	for tube, cached := range tubeStats {
+		ready, err := strconv.ParseFloat(cached.stats["current-jobs-ready"], 64)
+		if err != nil {
+			continue
+		}
+		samples := f.samples[tube]
+		if len(samples) == 0 || cached.fetchedAt.After(samples[len(samples)-1].at) {
+			samples = append(samples, forecastSample{at: cached.fetchedAt, ready: ready})
+		}
+		oldest := cached.fetchedAt.Add(-f.window)
+		for len(samples) > 0 && samples[0].at.Before(oldest) {
+			samples = samples[1:]
+		}
+		f.samples[tube] = samples
+
+		if len(samples) < minForecastSamples {
+			continue
+		}
+		slope, intercept, ok := fitLine(samples)
+		if !ok {
+			continue
+		}
+		f.slope.WithLabelValues(tube).Set(slope)
+
+		latest := samples[len(samples)-1]
+		switch {
+		case latest.ready >= f.threshold:
+			f.secondsToThreshold.WithLabelValues(tube).Set(0)
+		case slope > 0:
+			// The line is fitted to the seconds since the oldest sample.
+			elapsed := latest.at.Sub(samples[0].at).Seconds()
+			reached := (f.threshold - intercept) / slope
+			if reached < elapsed {
+				reached = elapsed
+			}
+			f.secondsToThreshold.WithLabelValues(tube).Set(reached - elapsed)
+		}
+	}
+}
+
+// fitLine returns the least squares line of the ready jobs against the
+// seconds since the oldest sample. There's no line when all the samples
+// are at the same time.
+func fitLine(samples []forecastSample) (slope, intercept float64, ok bool) {
+	n := float64(len(samples))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.at.Sub(samples[0].at).Seconds()
+		sumX += x
+		sumY += s.ready
+		sumXY += x * s.ready
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, 0, false
+	}
+	slope = (n*sumXY - sumX*sumY) / denominator
+	intercept = (sumY - slope*sumX) / n
+	return slope, intercept, true
+}
+
+func (f *backlogForecaster) describe(ch chan<- *prometheus.Desc) {
+	f.slope.Describe(ch)
+	f.secondsToThreshold.Describe(ch)
+}
+
+func (f *backlogForecaster) collect(ch chan<- prometheus.Metric) {
+	f.slope.Collect(ch)
+	f.secondsToThreshold.Collect(ch)
+}
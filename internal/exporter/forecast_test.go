@@ -0,0 +1,68 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+func TestBacklogForecaster(t *testing.T) {
+	forecaster := newBacklogForecaster(1000, 3*time.Minute)
+	start := time.Now()
+
+	tests := []struct {
+		num             string
+		minutes         int
+		ready           string
+		expectedSamples int
+		expectedSlope   float64
+		expectedSeconds float64
+		expectedMetrics int
+	}{
+		// We expect no forecast without enough samples.
+		{num: "1) ", minutes: 0, ready: "100", expectedSamples: 1},
+		{num: "2) ", minutes: 1, ready: "160", expectedSamples: 2},
+		// We expect the time until the threshold from the fitted line.
+		{num: "3) ", minutes: 2, ready: "220", expectedSamples: 3, expectedSlope: 1, expectedSeconds: 780, expectedMetrics: 2},
+		// We expect the stats cached from the previous scrape not to be sampled again.
+		{num: "4) ", minutes: 2, ready: "220", expectedSamples: 3, expectedSlope: 1, expectedSeconds: 780, expectedMetrics: 2},
+		// We expect no time until the threshold while the ready jobs aren't growing.
+		{num: "5) ", minutes: 3, ready: "40", expectedSamples: 4, expectedSlope: -0.2, expectedMetrics: 1},
+		// We expect the samples outside the window to be forgotten.
+		{num: "6) ", minutes: 5, ready: "100", expectedSamples: 3, expectedSlope: -0.5, expectedMetrics: 1},
+		// We expect no time until the threshold once it's reached.
+		{num: "7) ", minutes: 6, ready: "1075", expectedSamples: 3, expectedSlope: 5, expectedSeconds: 0, expectedMetrics: 2},
+	}
+	for _, tt := range tests {
+		forecaster.observe(map[string]cachedTubeStats{
+			"default": {
+				stats:     beanstalkd.TubeStats{"current-jobs-ready": tt.ready},
+				fetchedAt: start.Add(time.Duration(tt.minutes) * time.Minute),
+			},
+		})
+		if actual := len(forecaster.samples["default"]); tt.expectedSamples != actual {
+			t.Errorf(tt.num+"expected %v samples, actual %v", tt.expectedSamples, actual)
+		}
+		metrics := len(collectAll(forecaster.slope)) + len(collectAll(forecaster.secondsToThreshold))
+		if tt.expectedMetrics != metrics {
+			t.Errorf(tt.num+"expected %v metrics, actual %v", tt.expectedMetrics, metrics)
+		}
+		if metrics > 0 {
+			if actual := readGauge(forecaster.slope.WithLabelValues("default")); tt.expectedSlope != actual {
+				t.Errorf(tt.num+"expected slope %v, actual %v", tt.expectedSlope, actual)
+			}
+		}
+		if metrics > 1 {
+			if actual := readGauge(forecaster.secondsToThreshold.WithLabelValues("default")); tt.expectedSeconds != actual {
+				t.Errorf(tt.num+"expected seconds %v, actual %v", tt.expectedSeconds, actual)
+			}
+		}
+	}
+
+	// We expect the tubes that are no longer scraped to be forgotten.
+	forecaster.observe(map[string]cachedTubeStats{})
+	if expected, actual := 0, len(forecaster.samples); expected != actual {
+		t.Errorf("expected %v tubes, actual %v", expected, actual)
+	}
+}
@@ -0,0 +1,116 @@
+package exporter
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// headJobsFetcher is implemented by a BeanstalkdServer that can
+// fetch the jobs at the head of a tube's queues.
+type headJobsFetcher interface {
+	FetchTubeHeadJobs(tube string) (beanstalkd.TubeHeadJobs, error)
+}
+
+// headJobsMetrics are the metrics about the jobs at the head of
+// a tube's queues. There's no metric for a queue that's empty.
+type headJobsMetrics struct {
+	server headJobsFetcher
+
+	readyAge        *prometheus.GaugeVec
+	delayedTimeLeft *prometheus.GaugeVec
+	buriedAge       *prometheus.GaugeVec
+}
+
+func newHeadJobsMetrics(server headJobsFetcher) *headJobsMetrics {
+	return &headJobsMetrics{
+		server: server,
+		readyAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_oldest_ready_job_age_seconds",
+			Help:      "The age of the job at the head of the ready queue for this tube.",
+		}, []string{"tube"}),
+		delayedTimeLeft: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_next_delayed_job_time_left_seconds",
+			Help:      "The number of seconds until the next delayed job for this tube is ready.",
+		}, []string{"tube"}),
+		buriedAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_oldest_buried_job_age_seconds",
+			Help:      "The age of the job at the head of the buried queue for this tube.",
+		}, []string{"tube"}),
+	}
+}
+
+// scrape fetches the head jobs of the tubes, replacing the metrics
+// of previous scrapes.
+func (h *headJobsMetrics) scrape(tubes []string) error {
+	h.readyAge.Reset()
+	h.delayedTimeLeft.Reset()
+	h.buriedAge.Reset()
+
+	sorted := make([]string, len(tubes))
+	copy(sorted, tubes)
+	sort.Strings(sorted)
+	for _, tube := range sorted {
+		head, err := h.server.FetchTubeHeadJobs(tube)
+		if err != nil {
+			return err
+		}
+		setJobStat(h.readyAge, tube, head.Ready, "age")
+		setJobStat(h.delayedTimeLeft, tube, head.Delayed, "time-left")
+		setJobStat(h.buriedAge, tube, head.Buried, "age")
+	}
+	return nil
+}
+
+// setJobStat sets the metric for the tube from a job stat, unless
+// there's no job (or the stat isn't a number).
+func setJobStat(metric *prometheus.GaugeVec, tube string, job beanstalkd.JobStats, stat string) {
+	if job == nil {
+		return
+	}
+	v, err := strconv.ParseInt(job[stat], 10, 64)
+	if err != nil {
+		return
+	}
+	metric.WithLabelValues(tube).Set(float64(v))
+}
+
+func (h *headJobsMetrics) describe(ch chan<- *prometheus.Desc) {
+	h.readyAge.Describe(ch)
+	h.delayedTimeLeft.Describe(ch)
+	h.buriedAge.Describe(ch)
+}
+
+func (h *headJobsMetrics) collect(ch chan<- prometheus.Metric) {
+	h.readyAge.Collect(ch)
+	h.delayedTimeLeft.Collect(ch)
+	h.buriedAge.Collect(ch)
+}
+
+// scrapeHeadJobs fetches the head jobs of the configured tubes that
+// exist in beanstalkd (peeking at the other tubes would create them).
+func (b *BeanstalkdCollector) scrapeHeadJobs() error {
+	if b.headJobs == nil {
+		return nil
+	}
+	return b.headJobs.scrape(b.existingTubes(b.opts.HeadJobTubes))
+}
+
+// existingTubes returns the tubes that exist in beanstalkd, according
+// to the tube stats fetched in this scrape. The stats remembered from
+// previous scrapes (when scraping the tubes round-robin) are left out,
+// as the tubes may have been deleted since.
+func (b *BeanstalkdCollector) existingTubes(tubes []string) []string {
+	var existing []string
+	for _, tube := range tubes {
+		if cached, ok := b.tubeStats[tube]; ok && cached.fetchedAt.Equal(b.tubeStatsAt) {
+			existing = append(existing, tube)
+		}
+	}
+	return existing
+}
@@ -0,0 +1,160 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+func TestHeadJobsMetrics(t *testing.T) {
+	server := &mockHeadJobsFetcher{
+		mockBeanstalkdServer: *mockHealthyBeanstalkd(),
+		headJobs: map[string]beanstalkd.TubeHeadJobs{
+			"default": {
+				Ready:   beanstalkd.JobStats{"age": "300"},
+				Delayed: beanstalkd.JobStats{"time-left": "60"},
+				Buried:  beanstalkd.JobStats{"age": "900"},
+			},
+			"anotherTube": {
+				Ready: beanstalkd.JobStats{"age": "5"},
+			},
+		},
+	}
+	collector, err := NewBeanstalkdCollector(
+		server,
+		CollectorOpts{
+			Tubes:        []string{"default", "anotherTube"},
+			HeadJobTubes: []string{"default", "anotherTube", "missingTube"},
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if collector.headJobs == nil {
+		t.Fatal("expected head jobs metrics")
+	}
+	collectAll(collector)
+
+	// We expect the tube that doesn't exist not to be peeked at.
+	if expected, actual := []string{"anotherTube", "default"}, server.peeked; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected to peek %v, actual %v", expected, actual)
+	}
+
+	tests := []struct {
+		num      string
+		actual   float64
+		expected float64
+	}{
+		{num: "1) ", actual: readGauge(collector.headJobs.readyAge.WithLabelValues("default")), expected: 300},
+		{num: "2) ", actual: readGauge(collector.headJobs.delayedTimeLeft.WithLabelValues("default")), expected: 60},
+		{num: "3) ", actual: readGauge(collector.headJobs.buriedAge.WithLabelValues("default")), expected: 900},
+		{num: "4) ", actual: readGauge(collector.headJobs.readyAge.WithLabelValues("anotherTube")), expected: 5},
+	}
+	for _, tt := range tests {
+		if tt.expected != tt.actual {
+			t.Errorf(tt.num+"expected %v, actual %v", tt.expected, tt.actual)
+		}
+	}
+
+	// We expect no metrics for empty queues.
+	if expected, actual := 2, len(collectAll(collector.headJobs.readyAge)); expected != actual {
+		t.Errorf("expected %v ready metrics, actual %v", expected, actual)
+	}
+	if expected, actual := 1, len(collectAll(collector.headJobs.buriedAge)); expected != actual {
+		t.Errorf("expected %v buried metrics, actual %v", expected, actual)
+	}
+}
+
+func TestHeadJobsRoundRobin(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	server := &mockHeadJobsFetcher{
+		mockBeanstalkdServer: *mockHealthyBeanstalkd(),
+	}
+	collector, err := NewBeanstalkdCollector(
+		server,
+		CollectorOpts{
+			AllTubes:       true,
+			TubesPerScrape: 1,
+			HeadJobTubes:   []string{"default", "anotherTube"},
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	collector.now = func() time.Time { return now }
+
+	// We expect only the tube fetched in each scrape to be peeked at,
+	// as the remembered tubes may have been deleted since.
+	tests := []struct {
+		num      string
+		expected []string
+	}{
+		{num: "1) ", expected: []string{"anotherTube"}},
+		{num: "2) ", expected: []string{"default"}},
+	}
+	for _, tt := range tests {
+		server.peeked = nil
+		collectAll(collector)
+		if !reflect.DeepEqual(tt.expected, server.peeked) {
+			t.Errorf(tt.num+"expected to peek %v, actual %v", tt.expected, server.peeked)
+		}
+		now = now.Add(10 * time.Second)
+	}
+}
+
+func TestHeadJobsError(t *testing.T) {
+	server := &mockHeadJobsFetcher{
+		mockBeanstalkdServer: *mockHealthyBeanstalkd(),
+		headJobsError:        errUnexpected,
+	}
+	collector, err := NewBeanstalkdCollector(
+		server,
+		CollectorOpts{
+			Tubes:        []string{"default"},
+			HeadJobTubes: []string{"default"},
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	metrics := collectAll(collector)
+	if expected, actual := 0., readMetric(metrics[0]).GetGauge().GetValue(); expected != actual {
+		t.Errorf("expected 'up' value %v, actual %v", expected, actual)
+	}
+}
+
+func TestNoHeadJobsMetrics(t *testing.T) {
+	collector, err := NewBeanstalkdCollector(
+		mockHealthyBeanstalkd(),
+		CollectorOpts{
+			Tubes:        []string{"default"},
+			HeadJobTubes: []string{"default"},
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if collector.headJobs != nil {
+		t.Error("expected no head jobs metrics")
+	}
+}
+
+/********************     MOCKS     ********************/
+
+type mockHeadJobsFetcher struct {
+	mockBeanstalkdServer
+	headJobs      map[string]beanstalkd.TubeHeadJobs
+	headJobsError error
+	peeked        []string
+}
+
+func (m *mockHeadJobsFetcher) FetchTubeHeadJobs(tube string) (beanstalkd.TubeHeadJobs, error) {
+	m.peeked = append(m.peeked, tube)
+	return m.headJobs[tube], m.headJobsError
+}
@@ -0,0 +1,162 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultJobLabelField     = "type"
+	defaultJobLabelMaxValues = 20
+
+	// jobLabelOther is the label for values beyond the
+	// maximum number of distinct values of a tube.
+	jobLabelOther = "__other__"
+	// jobLabelUnknown is the label for jobs that aren't JSON,
+	// or don't have the field.
+	jobLabelUnknown = "__unknown__"
+)
+
+// readyJobPeeker is implemented by a BeanstalkdServer that can
+// peek at the job at the head of a tube's ready queue.
+type readyJobPeeker interface {
+	PeekTubeReadyJob(tube string) (*beanstalkd.Job, error)
+}
+
+// jobLabelSampler samples the jobs at the head of a tube's ready queue,
+// labelling them by a field of their JSON body. Each job is only counted
+// once, and each tube has at most maxValues distinct labels.
+type jobLabelSampler struct {
+	server    readyJobPeeker
+	field     []string
+	maxValues int
+	values    map[string]map[string]bool
+	sampled   map[string]uint64
+
+	sampledJobs *prometheus.CounterVec
+	age         *prometheus.GaugeVec
+}
+
+func newJobLabelSampler(server readyJobPeeker, field string, maxValues int) *jobLabelSampler {
+	return &jobLabelSampler{
+		server:    server,
+		field:     strings.Split(strings.TrimPrefix(field, "$."), "."),
+		maxValues: maxValues,
+		values:    make(map[string]map[string]bool),
+		sampled:   make(map[string]uint64),
+		sampledJobs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tube_sampled_jobs_total",
+			Help:      "The cumulative number of jobs sampled from the head of the ready queue for this tube, by job type.",
+		}, []string{"tube", "job_type"}),
+		age: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_sampled_job_age_seconds",
+			Help:      "The age of the job at the head of the ready queue for this tube, by job type.",
+		}, []string{"tube", "job_type"}),
+	}
+}
+
+// sample peeks at the ready jobs of the tubes, replacing the
+// ages of previous scrapes.
+func (s *jobLabelSampler) sample(tubes []string) error {
+	s.age.Reset()
+
+	sorted := make([]string, len(tubes))
+	copy(sorted, tubes)
+	sort.Strings(sorted)
+
+	sampled := make(map[string]uint64, len(sorted))
+	for _, tube := range sorted {
+		job, err := s.server.PeekTubeReadyJob(tube)
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			continue
+		}
+		label := s.label(tube, job.Body)
+		if s.sampled[tube] != job.ID {
+			s.sampledJobs.WithLabelValues(tube, label).Inc()
+		}
+		sampled[tube] = job.ID
+		if age, err := strconv.ParseInt(job.Stats["age"], 10, 64); err == nil {
+			s.age.WithLabelValues(tube, label).Set(float64(age))
+		}
+	}
+	s.sampled = sampled
+	return nil
+}
+
+// label returns the label for a job body in the tube.
+func (s *jobLabelSampler) label(tube string, body []byte) string {
+	value, ok := jsonField(body, s.field)
+	if !ok {
+		return jobLabelUnknown
+	}
+	if s.values[tube] == nil {
+		s.values[tube] = make(map[string]bool)
+	}
+	if !s.values[tube][value] {
+		if len(s.values[tube]) >= s.maxValues {
+			return jobLabelOther
+		}
+		s.values[tube][value] = true
+	}
+	return value
+}
+
+// jsonField returns the value of the field at the path in the
+// JSON body. Only strings, numbers and booleans are returned.
+func jsonField(body []byte, path []string) (string, bool) {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "", false
+	}
+	for _, key := range path {
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if v, ok = object[key]; !ok {
+			return "", false
+		}
+	}
+	switch value := v.(type) {
+	case string:
+		return value, true
+	case float64, bool:
+		return fmt.Sprint(value), true
+	}
+	return "", false
+}
+
+func (s *jobLabelSampler) describe(ch chan<- *prometheus.Desc) {
+	s.sampledJobs.Describe(ch)
+	s.age.Describe(ch)
+}
+
+// collect collects the sampled jobs, and the ages when the
+// beanstalkd stats are exposed.
+func (s *jobLabelSampler) collect(ch chan<- prometheus.Metric, exposeStats bool) {
+	s.sampledJobs.Collect(ch)
+	if exposeStats {
+		s.age.Collect(ch)
+	}
+}
+
+// sampleJobLabels samples the ready jobs of the configured tubes that
+// exist in beanstalkd. Like sampleBodySizes, the connection uses the
+// default tube again after peeking at each tube.
+func (b *BeanstalkdCollector) sampleJobLabels() error {
+	if b.jobLabels == nil {
+		return nil
+	}
+	return b.jobLabels.sample(b.existingTubes(b.opts.JobLabelTubes))
+}
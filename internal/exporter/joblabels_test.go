@@ -0,0 +1,157 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+func TestJSONField(t *testing.T) {
+	tests := []struct {
+		num           string
+		body          string
+		path          []string
+		expectedValue string
+		expectedOk    bool
+	}{
+		{num: "1) ", body: `{"type":"email"}`, path: []string{"type"}, expectedValue: "email", expectedOk: true},
+		{num: "2) ", body: `{"meta":{"type":"sms"}}`, path: []string{"meta", "type"}, expectedValue: "sms", expectedOk: true},
+		{num: "3) ", body: `{"type":42}`, path: []string{"type"}, expectedValue: "42", expectedOk: true},
+		{num: "4) ", body: `{"type":true}`, path: []string{"type"}, expectedValue: "true", expectedOk: true},
+		// We expect objects, missing fields and bodies that aren't JSON to have no value.
+		{num: "5) ", body: `{"type":{"name":"email"}}`, path: []string{"type"}, expectedValue: "", expectedOk: false},
+		{num: "6) ", body: `{"kind":"email"}`, path: []string{"type"}, expectedValue: "", expectedOk: false},
+		{num: "7) ", body: `["email"]`, path: []string{"type"}, expectedValue: "", expectedOk: false},
+		{num: "8) ", body: `not json`, path: []string{"type"}, expectedValue: "", expectedOk: false},
+	}
+
+	for _, tt := range tests {
+		value, ok := jsonField([]byte(tt.body), tt.path)
+		if tt.expectedValue != value || tt.expectedOk != ok {
+			t.Errorf(tt.num+"expected %v %v, actual %v %v", tt.expectedValue, tt.expectedOk, value, ok)
+		}
+	}
+}
+
+func TestJobLabelSampler(t *testing.T) {
+	server := &mockReadyJobPeeker{
+		mockBeanstalkdServer: *mockHealthyBeanstalkd(),
+	}
+	collector, err := NewBeanstalkdCollector(
+		server,
+		CollectorOpts{
+			Tubes:             []string{"default"},
+			JobLabelTubes:     []string{"default"},
+			JobLabelField:     "$.meta.type",
+			JobLabelMaxValues: 2,
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if collector.jobLabels == nil {
+		t.Fatal("expected a job label sampler")
+	}
+
+	tests := []struct {
+		num           string
+		job           *beanstalkd.Job
+		expectedLabel string
+		expectedCount float64
+		expectedAge   float64
+	}{
+		{num: "1) ", job: mockJSONJob(1, `{"meta":{"type":"email"}}`, "10"), expectedLabel: "email", expectedCount: 1, expectedAge: 10},
+		// We expect a job still at the head not to be counted again.
+		{num: "2) ", job: mockJSONJob(1, `{"meta":{"type":"email"}}`, "20"), expectedLabel: "email", expectedCount: 1, expectedAge: 20},
+		{num: "3) ", job: mockJSONJob(2, `{"meta":{"type":"email"}}`, "5"), expectedLabel: "email", expectedCount: 2, expectedAge: 5},
+		{num: "4) ", job: mockJSONJob(3, `{"meta":{"type":"sms"}}`, "1"), expectedLabel: "sms", expectedCount: 1, expectedAge: 1},
+		// We expect values beyond the max to be "other".
+		{num: "5) ", job: mockJSONJob(4, `{"meta":{"type":"push"}}`, "1"), expectedLabel: jobLabelOther, expectedCount: 1, expectedAge: 1},
+		{num: "6) ", job: mockJSONJob(5, `not json`, "1"), expectedLabel: jobLabelUnknown, expectedCount: 1, expectedAge: 1},
+	}
+
+	for _, tt := range tests {
+		server.job = tt.job
+		collectAll(collector)
+		if actual := readCounter(collector.jobLabels.sampledJobs.WithLabelValues("default", tt.expectedLabel)); tt.expectedCount != actual {
+			t.Errorf(tt.num+"expected %v sampled jobs, actual %v", tt.expectedCount, actual)
+		}
+		// We expect only the age of the current head job.
+		if expected, actual := 1, len(collectAll(collector.jobLabels.age)); expected != actual {
+			t.Errorf(tt.num+"expected %v ages, actual %v", expected, actual)
+		}
+		if actual := readGauge(collector.jobLabels.age.WithLabelValues("default", tt.expectedLabel)); tt.expectedAge != actual {
+			t.Errorf(tt.num+"expected age %v, actual %v", tt.expectedAge, actual)
+		}
+	}
+
+	// We expect no age when the ready queue is empty.
+	server.job = nil
+	collectAll(collector)
+	if expected, actual := 0, len(collectAll(collector.jobLabels.age)); expected != actual {
+		t.Errorf("expected %v ages, actual %v", expected, actual)
+	}
+}
+
+func TestJobLabelSamplerRoundRobin(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	server := &mockReadyJobPeeker{
+		mockBeanstalkdServer: *mockHealthyBeanstalkd(),
+	}
+	collector, err := NewBeanstalkdCollector(
+		server,
+		CollectorOpts{
+			AllTubes:          true,
+			TubesPerScrape:    1,
+			JobLabelTubes:     []string{"default", "anotherTube"},
+			JobLabelField:     "$.meta.type",
+			JobLabelMaxValues: 2,
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	collector.now = func() time.Time { return now }
+
+	// We expect only the tube fetched in each scrape to be sampled.
+	tests := []struct {
+		num      string
+		expected []string
+	}{
+		{num: "1) ", expected: []string{"anotherTube"}},
+		{num: "2) ", expected: []string{"default"}},
+	}
+	for _, tt := range tests {
+		server.peeked = nil
+		collectAll(collector)
+		if !reflect.DeepEqual(tt.expected, server.peeked) {
+			t.Errorf(tt.num+"expected to peek %v, actual %v", tt.expected, server.peeked)
+		}
+		now = now.Add(10 * time.Second)
+	}
+}
+
+/********************     MOCKS     ********************/
+
+type mockReadyJobPeeker struct {
+	mockBeanstalkdServer
+	job    *beanstalkd.Job
+	peeked []string
+}
+
+func (m *mockReadyJobPeeker) PeekTubeReadyJob(tube string) (*beanstalkd.Job, error) {
+	m.peeked = append(m.peeked, tube)
+	return m.job, nil
+}
+
+func mockJSONJob(id uint64, body string, age string) *beanstalkd.Job {
+	return &beanstalkd.Job{
+		ID:    id,
+		Body:  []byte(body),
+		Stats: beanstalkd.JobStats{"age": age},
+	}
+}
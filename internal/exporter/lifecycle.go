@@ -0,0 +1,101 @@
+package exporter
+
+import (
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const defaultMaxTrackedTubes = 10000
+
+// tubeTracker remembers the tubes seen across scrapes, so that
+// tubes being created and deleted by beanstalkd can be counted.
+// Only the tubes that currently exist are remembered, and never
+// more than maxTubes of them. A tube that's ignored because there
+// are too many is counted as created when it's admitted later.
+type tubeTracker struct {
+	maxTubes  int
+	seeded    bool
+	full      bool
+	firstSeen map[string]time.Time
+
+	firstSeenMetric *prometheus.GaugeVec
+	created         prometheus.Counter
+	disappeared     prometheus.Counter
+}
+
+func newTubeTracker(maxTubes int) *tubeTracker {
+	return &tubeTracker{
+		maxTubes:  maxTubes,
+		firstSeen: make(map[string]time.Time),
+		firstSeenMetric: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_first_seen_timestamp_seconds",
+			Help:      "The unix time when the exporter first saw this tube.",
+		}, []string{"tube"}),
+		created: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tubes_created_total",
+			Help:      "The cumulative number of tubes that appeared since the exporter started.",
+		}),
+		disappeared: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tubes_disappeared_total",
+			Help:      "The cumulative number of tubes that disappeared since the exporter started.",
+		}),
+	}
+}
+
+// observe records the tubes that exist now, returning the tubes that
+// were created and the tubes that disappeared since the last observation.
+// The tubes seen in the first observation are not counted as created.
+func (t *tubeTracker) observe(tubes []string, now time.Time) (created []string, disappeared []string) {
+	exists := make(map[string]bool, len(tubes))
+	for _, tube := range tubes {
+		exists[tube] = true
+	}
+
+	for tube := range t.firstSeen {
+		if !exists[tube] {
+			delete(t.firstSeen, tube)
+			t.firstSeenMetric.DeleteLabelValues(tube)
+			t.disappeared.Inc()
+			disappeared = append(disappeared, tube)
+		}
+	}
+
+	t.full = false
+	for _, tube := range tubes {
+		if _, ok := t.firstSeen[tube]; ok {
+			continue
+		}
+		if len(t.firstSeen) >= t.maxTubes {
+			t.full = true
+			continue
+		}
+		t.firstSeen[tube] = now
+		t.firstSeenMetric.WithLabelValues(tube).Set(float64(now.Unix()))
+		if t.seeded {
+			t.created.Inc()
+			created = append(created, tube)
+		}
+	}
+	t.seeded = true
+
+	sort.Strings(created)
+	sort.Strings(disappeared)
+	return created, disappeared
+}
+
+func (t *tubeTracker) describe(ch chan<- *prometheus.Desc) {
+	t.firstSeenMetric.Describe(ch)
+	t.created.Describe(ch)
+	t.disappeared.Describe(ch)
+}
+
+func (t *tubeTracker) collect(ch chan<- prometheus.Metric) {
+	t.firstSeenMetric.Collect(ch)
+	t.created.Collect(ch)
+	t.disappeared.Collect(ch)
+}
@@ -0,0 +1,109 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTubeTrackerObserve(t *testing.T) {
+	tracker := newTubeTracker(10)
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		num                      string
+		tubes                    []string
+		now                      time.Time
+		expectedCreated          []string
+		expectedDisappeared      []string
+		expectedCreatedTotal     float64
+		expectedDisappearedTotal float64
+	}{
+		// We expect the first observation to only seed the tracker.
+		{
+			num:                      "1) ",
+			tubes:                    []string{"default", "one"},
+			now:                      start,
+			expectedCreated:          nil,
+			expectedDisappeared:      nil,
+			expectedCreatedTotal:     0,
+			expectedDisappearedTotal: 0,
+		},
+		// We expect new tubes to be counted as created.
+		{
+			num:                      "2) ",
+			tubes:                    []string{"default", "one", "two"},
+			now:                      start.Add(time.Minute),
+			expectedCreated:          []string{"two"},
+			expectedDisappeared:      nil,
+			expectedCreatedTotal:     1,
+			expectedDisappearedTotal: 0,
+		},
+		// We expect missing tubes to be counted as disappeared.
+		{
+			num:                      "3) ",
+			tubes:                    []string{"default", "three"},
+			now:                      start.Add(2 * time.Minute),
+			expectedCreated:          []string{"three"},
+			expectedDisappeared:      []string{"one", "two"},
+			expectedCreatedTotal:     2,
+			expectedDisappearedTotal: 2,
+		},
+		// We expect a tube that comes back to be created again.
+		{
+			num:                      "4) ",
+			tubes:                    []string{"default", "one", "three"},
+			now:                      start.Add(3 * time.Minute),
+			expectedCreated:          []string{"one"},
+			expectedDisappeared:      nil,
+			expectedCreatedTotal:     3,
+			expectedDisappearedTotal: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		created, disappeared := tracker.observe(tt.tubes, tt.now)
+		if !reflect.DeepEqual(tt.expectedCreated, created) {
+			t.Errorf(tt.num+"expected created %v, actual %v", tt.expectedCreated, created)
+		}
+		if !reflect.DeepEqual(tt.expectedDisappeared, disappeared) {
+			t.Errorf(tt.num+"expected disappeared %v, actual %v", tt.expectedDisappeared, disappeared)
+		}
+		if actual := readCounter(tracker.created); tt.expectedCreatedTotal != actual {
+			t.Errorf(tt.num+"expected created total %v, actual %v", tt.expectedCreatedTotal, actual)
+		}
+		if actual := readCounter(tracker.disappeared); tt.expectedDisappearedTotal != actual {
+			t.Errorf(tt.num+"expected disappeared total %v, actual %v", tt.expectedDisappearedTotal, actual)
+		}
+	}
+
+	// We expect the first seen time to be kept for tubes that still exist,
+	// and reset for tubes that came back.
+	if expected, actual := float64(start.Unix()), readGauge(tracker.firstSeenMetric.WithLabelValues("default")); expected != actual {
+		t.Errorf("expected 'default' first seen %v, actual %v", expected, actual)
+	}
+	if expected, actual := float64(start.Add(3*time.Minute).Unix()), readGauge(tracker.firstSeenMetric.WithLabelValues("one")); expected != actual {
+		t.Errorf("expected 'one' first seen %v, actual %v", expected, actual)
+	}
+}
+
+func TestTubeTrackerMaxTubes(t *testing.T) {
+	tracker := newTubeTracker(2)
+	tracker.observe([]string{"a", "b", "c"}, time.Now())
+	if !tracker.full {
+		t.Error("expected the tracker to be full")
+	}
+	if expected, actual := 2, len(tracker.firstSeen); expected != actual {
+		t.Errorf("expected %v tracked tubes, actual %v", expected, actual)
+	}
+
+	// We expect room for new tubes once tubes disappear (counting
+	// the tube that was ignored as created).
+	created, _ := tracker.observe([]string{"c"}, time.Now())
+	if !reflect.DeepEqual([]string{"c"}, created) {
+		t.Errorf("expected created [c], actual %v", created)
+	}
+	if tracker.full {
+		t.Error("expected the tracker not to be full")
+	}
+}
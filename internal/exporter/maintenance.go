@@ -0,0 +1,225 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maintenanceAllTubes is the pattern of a maintenance window that
+// covers the whole of beanstalkd, including its system stats.
+const maintenanceAllTubes = "*"
+
+// MaintenanceWindow is a scheduled maintenance of the tubes matching a
+// pattern (like "emails*", or "*" for the whole of beanstalkd), starting
+// at each minute of a cron-like schedule, for the duration.
+type MaintenanceWindow struct {
+	Name     string   `json:"name"`
+	Tubes    string   `json:"tubes"`
+	Schedule string   `json:"schedule"`
+	Duration Duration `json:"duration"`
+}
+
+// LoadMaintenanceWindows reads the maintenance windows from a JSON
+// file, as a list of windows.
+func LoadMaintenanceWindows(path string) ([]MaintenanceWindow, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var windows []MaintenanceWindow
+	if err := json.Unmarshal(b, &windows); err != nil {
+		return nil, fmt.Errorf("invalid maintenance file %v: %v", path, err)
+	}
+	return windows, nil
+}
+
+// ActiveMaintenance is a maintenance window in progress. The windows
+// started through Start don't have a name.
+type ActiveMaintenance struct {
+	Name   string
+	Tubes  string
+	EndsAt time.Time
+}
+
+// scheduledMaintenance is a maintenance window with a parsed schedule.
+type scheduledMaintenance struct {
+	window   MaintenanceWindow
+	schedule *cronSchedule
+}
+
+// Maintenance is the scheduled maintenance windows, and the windows
+// started on demand (like during a deploy). During a window the tubes
+// in maintenance are flagged, and their stalled and threshold signals
+// are suppressed.
+type Maintenance struct {
+	mutex     sync.Mutex
+	scheduled []scheduledMaintenance
+	started   map[string]time.Time
+
+	now func() time.Time
+}
+
+// NewMaintenance returns the maintenance for the scheduled windows,
+// which are in the local time of the exporter.
+func NewMaintenance(windows []MaintenanceWindow) (*Maintenance, error) {
+	m := &Maintenance{
+		started: make(map[string]time.Time),
+		now:     time.Now,
+	}
+	for _, window := range windows {
+		if err := validateMaintenancePattern(window.Tubes); err != nil {
+			return nil, fmt.Errorf("maintenance window %v: %v", window.Name, err)
+		}
+		schedule, err := parseCronSchedule(window.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window %v: %v", window.Name, err)
+		}
+		if window.Duration < Duration(time.Minute) {
+			return nil, fmt.Errorf("maintenance window %v: duration < 1m", window.Name)
+		}
+		m.scheduled = append(m.scheduled, scheduledMaintenance{window: window, schedule: schedule})
+	}
+	return m, nil
+}
+
+// validateMaintenancePattern returns an error for an invalid pattern of tubes.
+func validateMaintenancePattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("no tubes")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid tubes %v: %v", pattern, err)
+	}
+	return nil
+}
+
+// Start starts a maintenance of the tubes matching the pattern, for the
+// duration, replacing any window already started for the pattern.
+func (m *Maintenance) Start(tubes string, duration time.Duration) error {
+	if err := validateMaintenancePattern(tubes); err != nil {
+		return err
+	}
+	if duration <= 0 {
+		return fmt.Errorf("duration <= 0")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.started[tubes] = m.now().Add(duration)
+	return nil
+}
+
+// End ends the maintenance started for the pattern, returning false
+// when there isn't one. Scheduled windows can't be ended.
+func (m *Maintenance) End(tubes string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	endsAt, ok := m.started[tubes]
+	delete(m.started, tubes)
+	return ok && endsAt.After(m.now())
+}
+
+// Active returns the maintenance windows in progress, sorted by tubes.
+func (m *Maintenance) Active() []ActiveMaintenance {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := m.now()
+
+	var active []ActiveMaintenance
+	for tubes, endsAt := range m.started {
+		if !endsAt.After(now) {
+			delete(m.started, tubes)
+			continue
+		}
+		active = append(active, ActiveMaintenance{Tubes: tubes, EndsAt: endsAt})
+	}
+	for _, s := range m.scheduled {
+		// The most recent start of the window, within its duration.
+		duration := time.Duration(s.window.Duration)
+		for start := now.Truncate(time.Minute); now.Sub(start) < duration; start = start.Add(-time.Minute) {
+			if s.schedule.matches(start) {
+				active = append(active, ActiveMaintenance{
+					Name:   s.window.Name,
+					Tubes:  s.window.Tubes,
+					EndsAt: start.Add(duration),
+				})
+				break
+			}
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		if active[i].Tubes != active[j].Tubes {
+			return active[i].Tubes < active[j].Tubes
+		}
+		return active[i].Name < active[j].Name
+	})
+	return active
+}
+
+// covers returns true when any of the windows covers the tube. Only
+// the windows of the whole of beanstalkd cover the system stats,
+// which have no tube.
+func covers(windows []ActiveMaintenance, tube string) bool {
+	for _, window := range windows {
+		if window.Tubes == maintenanceAllTubes {
+			return true
+		}
+		if matched, _ := path.Match(window.Tubes, tube); matched && tube != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenanceMetrics flags the tubes in maintenance on each scrape.
+type maintenanceMetrics struct {
+	maintenance *Maintenance
+	active      []ActiveMaintenance
+
+	inMaintenance *prometheus.GaugeVec
+}
+
+func newMaintenanceMetrics(maintenance *Maintenance) *maintenanceMetrics {
+	return &maintenanceMetrics{
+		maintenance: maintenance,
+		inMaintenance: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "maintenance",
+			Help:      "Whether the tube is in a maintenance window (1 = in maintenance, 0 = not in maintenance).",
+		}, []string{"tube"}),
+	}
+}
+
+// refresh fetches the windows in progress for this scrape.
+func (m *maintenanceMetrics) refresh() {
+	m.active = m.maintenance.Active()
+}
+
+// observe flags the tubes in maintenance, replacing the
+// metrics of previous scrapes.
+func (m *maintenanceMetrics) observe(tubeStats map[string]cachedTubeStats) {
+	m.inMaintenance.Reset()
+	for tube := range tubeStats {
+		m.inMaintenance.WithLabelValues(tube).Set(boolToFloat(covers(m.active, tube)))
+	}
+}
+
+func (m *maintenanceMetrics) describe(ch chan<- *prometheus.Desc) {
+	m.inMaintenance.Describe(ch)
+}
+
+func (m *maintenanceMetrics) collect(ch chan<- prometheus.Metric) {
+	m.inMaintenance.Collect(ch)
+}
+
+// inMaintenance returns true when the tube (or beanstalkd, when the
+// tube is empty) is in maintenance during this scrape.
+func (b *BeanstalkdCollector) inMaintenance(tube string) bool {
+	return b.maintenance != nil && covers(b.maintenance.active, tube)
+}
@@ -0,0 +1,211 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceActive(t *testing.T) {
+	maintenance, err := NewMaintenance([]MaintenanceWindow{
+		{Name: "nightly", Tubes: "emails*", Schedule: "0 2 * * *", Duration: Duration(30 * time.Minute)},
+		{Name: "weekly", Tubes: "*", Schedule: "0 3 * * 0", Duration: Duration(time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	now := time.Date(2024, 3, 3, 2, 10, 30, 0, time.UTC)
+	maintenance.now = func() time.Time { return now }
+
+	// We expect the scheduled windows in progress.
+	expected := []ActiveMaintenance{
+		{Name: "nightly", Tubes: "emails*", EndsAt: time.Date(2024, 3, 3, 2, 30, 0, 0, time.UTC)},
+	}
+	if actual := maintenance.Active(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+
+	// We expect the started windows, replacing any started for the same tubes.
+	if err := maintenance.Start("deploy-*", time.Minute); err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if err := maintenance.Start("deploy-*", 5*time.Minute); err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	expected = []ActiveMaintenance{
+		{Tubes: "deploy-*", EndsAt: now.Add(5 * time.Minute)},
+		{Name: "nightly", Tubes: "emails*", EndsAt: time.Date(2024, 3, 3, 2, 30, 0, 0, time.UTC)},
+	}
+	if actual := maintenance.Active(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+
+	// We expect the windows to end.
+	now = time.Date(2024, 3, 3, 3, 0, 0, 0, time.UTC)
+	expected = []ActiveMaintenance{
+		{Name: "weekly", Tubes: "*", EndsAt: time.Date(2024, 3, 3, 4, 0, 0, 0, time.UTC)},
+	}
+	if actual := maintenance.Active(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+
+	// We expect a started window to be ended, but not a scheduled window.
+	if err := maintenance.Start("deploy-*", time.Minute); err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if !maintenance.End("deploy-*") {
+		t.Error("expected the started window to be ended")
+	}
+	if maintenance.End("*") {
+		t.Error("expected the scheduled window not to be ended")
+	}
+	if actual := maintenance.Active(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, actual %v", expected, actual)
+	}
+}
+
+func TestMaintenanceErrors(t *testing.T) {
+	tests := []struct {
+		num           string
+		window        MaintenanceWindow
+		expectedError string
+	}{
+		{
+			num:           "1) ",
+			window:        MaintenanceWindow{Name: "nightly", Schedule: "0 2 * * *", Duration: Duration(time.Hour)},
+			expectedError: "maintenance window nightly: no tubes",
+		},
+		{
+			num:           "2) ",
+			window:        MaintenanceWindow{Name: "nightly", Tubes: "[", Schedule: "0 2 * * *", Duration: Duration(time.Hour)},
+			expectedError: "maintenance window nightly: invalid tubes [: syntax error in pattern",
+		},
+		{
+			num:           "3) ",
+			window:        MaintenanceWindow{Name: "nightly", Tubes: "*", Schedule: "0 2 * *", Duration: Duration(time.Hour)},
+			expectedError: "maintenance window nightly: invalid schedule, expected 5 fields: 0 2 * *",
+		},
+		{
+			num:           "4) ",
+			window:        MaintenanceWindow{Name: "nightly", Tubes: "*", Schedule: "0 2 * * *", Duration: Duration(time.Second)},
+			expectedError: "maintenance window nightly: duration < 1m",
+		},
+	}
+	for _, tt := range tests {
+		_, err := NewMaintenance([]MaintenanceWindow{tt.window})
+		if err == nil || err.Error() != tt.expectedError {
+			t.Errorf(tt.num+"expected error %v, actual %v", tt.expectedError, err)
+		}
+	}
+
+	maintenance, err := NewMaintenance(nil)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if err := maintenance.Start("", time.Minute); err == nil {
+		t.Error("expected error for no tubes, actual nil")
+	}
+	if err := maintenance.Start("*", 0); err == nil {
+		t.Error("expected error for no duration, actual nil")
+	}
+}
+
+func TestMaintenanceCovers(t *testing.T) {
+	tests := []struct {
+		num      string
+		windows  []ActiveMaintenance
+		tube     string
+		expected bool
+	}{
+		{num: "1) ", windows: nil, tube: "emails", expected: false},
+		{num: "2) ", windows: []ActiveMaintenance{{Tubes: "emails*"}}, tube: "emails-high", expected: true},
+		{num: "3) ", windows: []ActiveMaintenance{{Tubes: "emails*"}}, tube: "default", expected: false},
+		// We expect only the windows of the whole of beanstalkd to cover the system stats.
+		{num: "4) ", windows: []ActiveMaintenance{{Tubes: "emails*"}}, tube: "", expected: false},
+		{num: "5) ", windows: []ActiveMaintenance{{Tubes: "*"}}, tube: "", expected: true},
+		{num: "6) ", windows: []ActiveMaintenance{{Tubes: "*"}}, tube: "default", expected: true},
+	}
+	for _, tt := range tests {
+		if actual := covers(tt.windows, tt.tube); tt.expected != actual {
+			t.Errorf(tt.num+"expected %v, actual %v", tt.expected, actual)
+		}
+	}
+}
+
+func TestMaintenanceSuppression(t *testing.T) {
+	maintenance, err := NewMaintenance(nil)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	server := mockHealthyBeanstalkd()
+	server.tubesStats["default"].Stats["current-watching"] = "0"
+	server.tubesStats["default"].Stats["cmd-delete"] = "0"
+	notifier := &mockRuleNotifier{}
+	collector, err := NewBeanstalkdCollector(
+		server,
+		CollectorOpts{
+			AllTubes: true,
+			Rules: []Rule{
+				{Name: "backlog", Tube: "default", Stat: "current-jobs-ready", Op: RuleAbove, Threshold: 5},
+				{Name: "urgent", Stat: "current-jobs-urgent", Op: RuleAbove, Threshold: 5},
+			},
+			RuleNotifiers: []RuleNotifier{notifier},
+			Maintenance:   maintenance,
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+
+	tests := []struct {
+		num                   string
+		tubes                 string
+		expectedMaintenance   float64
+		expectedStalled       float64
+		expectedBacklog       float64
+		expectedUrgent        float64
+		expectedNotifications []string
+	}{
+		// We expect the signals outside of maintenance.
+		{num: "1) ", expectedMaintenance: 0, expectedStalled: 1, expectedBacklog: 1, expectedUrgent: 1, expectedNotifications: []string{"backlog firing", "urgent firing"}},
+		// We expect the signals of a tube in maintenance to be suppressed.
+		{num: "2) ", tubes: "def*", expectedMaintenance: 1, expectedStalled: 0, expectedBacklog: 0, expectedUrgent: 1, expectedNotifications: []string{"backlog resolved"}},
+		// We expect the system signals to be suppressed in maintenance of the whole of beanstalkd.
+		{num: "3) ", tubes: "*", expectedMaintenance: 1, expectedStalled: 0, expectedBacklog: 0, expectedUrgent: 0, expectedNotifications: []string{"urgent resolved"}},
+	}
+	for _, tt := range tests {
+		notifier.notifications = nil
+		if tt.tubes != "" {
+			if err := maintenance.Start(tt.tubes, time.Hour); err != nil {
+				t.Fatalf(tt.num+"expected nil error, actual %v", err)
+			}
+		}
+		collector.scrape()
+
+		if actual := readGauge(collector.maintenance.inMaintenance.WithLabelValues("default")); tt.expectedMaintenance != actual {
+			t.Errorf(tt.num+"expected maintenance %v, actual %v", tt.expectedMaintenance, actual)
+		}
+		if actual := readGauge(collector.stallDetector.stalled.WithLabelValues("default", stalledNoWatchers)); tt.expectedStalled != actual {
+			t.Errorf(tt.num+"expected stalled %v, actual %v", tt.expectedStalled, actual)
+		}
+		if actual := readGauge(collector.rules.firing.WithLabelValues("backlog")); tt.expectedBacklog != actual {
+			t.Errorf(tt.num+"expected backlog %v, actual %v", tt.expectedBacklog, actual)
+		}
+		if actual := readGauge(collector.rules.firing.WithLabelValues("urgent")); tt.expectedUrgent != actual {
+			t.Errorf(tt.num+"expected urgent %v, actual %v", tt.expectedUrgent, actual)
+		}
+		var actual []string
+		for _, n := range notifier.notifications {
+			actual = append(actual, n.Rule+" "+n.Status)
+		}
+		if !reflect.DeepEqual(tt.expectedNotifications, actual) {
+			t.Errorf(tt.num+"expected notifications %v, actual %v", tt.expectedNotifications, actual)
+		}
+	}
+}
+
+// noMaintenance is for when no tubes are in maintenance.
+func noMaintenance(string) bool {
+	return false
+}
@@ -0,0 +1,142 @@
+package exporter
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// frozenMetric is a copy of a metric's value at a point in time,
+// so that it doesn't change when the original metric changes.
+type frozenMetric struct {
+	desc   *prometheus.Desc
+	metric *dto.Metric
+}
+
+func freeze(m prometheus.Metric) (prometheus.Metric, error) {
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		return nil, err
+	}
+	return frozenMetric{desc: m.Desc(), metric: pb}, nil
+}
+
+func (f frozenMetric) Desc() *prometheus.Desc {
+	return f.desc
+}
+
+func (f frozenMetric) Write(out *dto.Metric) error {
+	out.Label = f.metric.Label
+	out.Gauge = f.metric.Gauge
+	out.Counter = f.metric.Counter
+	out.Summary = f.metric.Summary
+	out.Untyped = f.metric.Untyped
+	out.Histogram = f.metric.Histogram
+	out.TimestampMs = f.metric.TimestampMs
+	return nil
+}
+
+// Run polls beanstalkd every poll interval, until the context is done.
+// Nothing is polled when the collector isn't configured for polling.
+func (b *BeanstalkdCollector) Run(ctx context.Context) {
+	if b.opts.PollInterval == 0 {
+		return
+	}
+	ticker := time.NewTicker(b.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		b.poll()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll scrapes beanstalkd, and keeps a snapshot of the metrics
+// to be served by Collect.
+func (b *BeanstalkdCollector) poll() {
+	b.flight.do(b.takeSnapshot)
+}
+
+// refresh polls beanstalkd, unless the most recent snapshot is younger
+// than the minimum scrape interval (which is counted as throttled) or
+// the scrape reuse window. Concurrent refreshes share a single poll.
+func (b *BeanstalkdCollector) refresh() {
+	b.flight.do(func() {
+		b.snapshotMutex.RLock()
+		taken := !b.snapshotAt.IsZero()
+		age := b.now().Sub(b.snapshotAt)
+		b.snapshotMutex.RUnlock()
+		if taken && age < b.opts.MinScrapeInterval {
+			b.throttledScrapes.Inc()
+			return
+		}
+		if taken && age < b.opts.ScrapeReuseWindow {
+			return
+		}
+		b.takeSnapshot()
+	})
+}
+
+func (b *BeanstalkdCollector) takeSnapshot() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.resetMetrics()
+	b.scrape()
+
+	now := b.now()
+	if b.lastPoll != nil {
+		b.lastPoll.Set(float64(now.Unix()))
+	}
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		b.collectMetrics(metrics)
+	}()
+	var snapshot []prometheus.Metric
+	for m := range metrics {
+		frozen, err := freeze(m)
+		if err != nil {
+			b.logger.Error("error copying metric", "err", err)
+			continue
+		}
+		snapshot = append(snapshot, frozen)
+	}
+
+	b.snapshotMutex.Lock()
+	defer b.snapshotMutex.Unlock()
+	b.snapshot = snapshot
+	b.snapshotHealthy = b.healthy
+	b.snapshotAt = now
+}
+
+// collectSnapshot collects the metrics from the most recent poll.
+// beanstalkd is "down" when there hasn't been a poll yet, or when
+// polling in the background and the snapshot is older than the max
+// staleness.
+func (b *BeanstalkdCollector) collectSnapshot(ch chan<- prometheus.Metric) {
+	b.snapshotMutex.RLock()
+	defer b.snapshotMutex.RUnlock()
+
+	up := 0.
+	if b.snapshotHealthy {
+		up = 1
+	}
+	if b.opts.PollInterval > 0 && b.now().Sub(b.snapshotAt) > b.opts.MaxStaleness {
+		up = 0
+	}
+	ch <- prometheus.MustNewConstMetric(b.up.Desc(), prometheus.GaugeValue, up)
+	for _, m := range b.snapshot {
+		ch <- m
+	}
+	// Throttling happens between snapshots.
+	if b.throttledScrapes != nil {
+		b.throttledScrapes.Collect(ch)
+	}
+}
@@ -0,0 +1,138 @@
+package exporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func collectAll(c prometheus.Collector) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		defer close(ch)
+		c.Collect(ch)
+	}()
+	var metrics []prometheus.Metric
+	for m := range ch {
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+func readMetric(m prometheus.Metric) *dto.Metric {
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		return nil
+	}
+	return pb
+}
+
+func TestFreeze(t *testing.T) {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test"})
+	gauge.Set(1)
+	frozen, err := freeze(gauge)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	gauge.Set(2)
+	if expected, actual := 1., readMetric(frozen).GetGauge().GetValue(); expected != actual {
+		t.Errorf("expected frozen value %v, actual %v", expected, actual)
+	}
+	if frozen.Desc() != gauge.Desc() {
+		t.Error("expected the frozen metric to have the same desc")
+	}
+}
+
+func TestCollectServesSnapshot(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	server := mockHealthyBeanstalkd()
+	collector, err := NewBeanstalkdCollector(
+		server,
+		CollectorOpts{
+			SystemMetrics: []string{"current_jobs_urgent_count", "current_jobs_ready_count"},
+			PollInterval:  10 * time.Second,
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	collector.now = func() time.Time { return now }
+
+	// We expect beanstalkd to be "down" before the first poll.
+	metrics := collectAll(collector)
+	if expected, actual := 1, len(metrics); expected != actual {
+		t.Errorf("expected %v metrics before polling, actual %v", expected, actual)
+	}
+	if expected, actual := 0., readMetric(metrics[0]).GetGauge().GetValue(); expected != actual {
+		t.Errorf("expected 'up' value %v, actual %v", expected, actual)
+	}
+
+	collector.poll()
+
+	// We expect up, total scrapes, last success, 2 system metrics, restarts
+	// and the last poll time, without scraping beanstalkd again.
+	server.statsError = errUnexpected
+	metrics = collectAll(collector)
+	if expected, actual := 7, len(metrics); expected != actual {
+		t.Errorf("expected %v metrics, actual %v", expected, actual)
+	}
+	if expected, actual := 1., readMetric(metrics[0]).GetGauge().GetValue(); expected != actual {
+		t.Errorf("expected 'up' value %v, actual %v", expected, actual)
+	}
+	if expected, actual := 1., readCounter(collector.totalScrapes); expected != actual {
+		t.Errorf("expected 'totalScrapes' value %v, actual %v", expected, actual)
+	}
+	if expected, actual := float64(now.Unix()), readGauge(collector.lastPoll); expected != actual {
+		t.Errorf("expected last poll %v, actual %v", expected, actual)
+	}
+
+	// We expect beanstalkd to be "down" when the snapshot is too old.
+	now = now.Add(31 * time.Second)
+	metrics = collectAll(collector)
+	if expected, actual := 0., readMetric(metrics[0]).GetGauge().GetValue(); expected != actual {
+		t.Errorf("expected 'up' value %v, actual %v", expected, actual)
+	}
+
+	// We expect beanstalkd to be "down" when the poll fails.
+	collector.poll()
+	metrics = collectAll(collector)
+	if expected, actual := 0., readMetric(metrics[0]).GetGauge().GetValue(); expected != actual {
+		t.Errorf("expected 'up' value %v, actual %v", expected, actual)
+	}
+}
+
+func TestRunPollsUntilDone(t *testing.T) {
+	collector, err := NewBeanstalkdCollector(
+		mockHealthyBeanstalkd(),
+		CollectorOpts{PollInterval: time.Millisecond},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		collector.Run(ctx)
+	}()
+	for readCounter(collector.totalScrapes) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func TestValidateDefaultMaxStaleness(t *testing.T) {
+	opts := CollectorOpts{PollInterval: 10 * time.Second}
+	if err := opts.validate(); err != nil {
+		t.Errorf("expected nil error, actual %v", err)
+	}
+	if expected, actual := 30*time.Second, opts.MaxStaleness; expected != actual {
+		t.Errorf("expected max staleness %v, actual %v", expected, actual)
+	}
+}
@@ -0,0 +1,126 @@
+package exporter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stitchedCounter is a cumulative beanstalkd stat that keeps
+// increasing across beanstalkd restarts.
+type stitchedCounter struct {
+	desc   *prometheus.Desc
+	offset float64
+	last   float64
+	seen   bool
+}
+
+// restartTracker detects beanstalkd restarts, from a new pid or
+// a lower uptime than the previous scrape. When stitching, the
+// cumulative stats are carried over from the previous process.
+type restartTracker struct {
+	seeded bool
+	pid    string
+	uptime int64
+
+	restarts  prometheus.Counter
+	startTime prometheus.Gauge
+	stitched  map[string]*stitchedCounter
+}
+
+// isCumulativeSystemMetric returns true for the system metrics
+// that beanstalkd resets to zero when it restarts.
+func isCumulativeSystemMetric(metric string) bool {
+	return strings.HasPrefix(metric, "cmd_") || metric == "total_jobs_count"
+}
+
+func newRestartTracker(systemMetrics []string, stitch bool) *restartTracker {
+	t := &restartTracker{
+		restarts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "restarts_detected_total",
+			Help:      "The cumulative number of beanstalkd restarts detected since the exporter started.",
+		}),
+		startTime: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "start_time_seconds",
+			Help:      "The unix time when the beanstalkd process started.",
+		}),
+		stitched: make(map[string]*stitchedCounter),
+	}
+	if !stitch {
+		return t
+	}
+	for _, metric := range systemMetrics {
+		if !isCumulativeSystemMetric(metric) {
+			continue
+		}
+		t.stitched[descSystemMetrics[metric].stat] = &stitchedCounter{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "", "stitched_"+metric),
+				descSystemMetrics[metric].help+" Keeps increasing across beanstalkd restarts.",
+				nil, nil,
+			),
+		}
+	}
+	return t
+}
+
+// observe records the system stats of a scrape, returning true when
+// beanstalkd restarted since the previous scrape. Nothing is recorded
+// when the stats don't include the uptime.
+func (t *restartTracker) observe(stats beanstalkd.ServerStats, now time.Time) bool {
+	uptime, err := strconv.ParseInt(stats["uptime"], 10, 64)
+	if err != nil {
+		return false
+	}
+	pid := stats["pid"]
+
+	restarted := t.seeded && (pid != t.pid || uptime < t.uptime)
+	if restarted {
+		t.restarts.Inc()
+	}
+	for stat, counter := range t.stitched {
+		v, err := strconv.ParseFloat(stats[stat], 64)
+		if err != nil {
+			continue
+		}
+		if restarted && counter.seen {
+			counter.offset += counter.last
+		}
+		counter.last = v
+		counter.seen = true
+	}
+
+	t.seeded = true
+	t.pid = pid
+	t.uptime = uptime
+	t.startTime.Set(float64(now.Unix() - uptime))
+	return restarted
+}
+
+func (t *restartTracker) describe(ch chan<- *prometheus.Desc) {
+	t.restarts.Describe(ch)
+	t.startTime.Describe(ch)
+	for _, counter := range t.stitched {
+		ch <- counter.desc
+	}
+}
+
+// collect collects the restarts, and the beanstalkd stats when
+// they're exposed.
+func (t *restartTracker) collect(ch chan<- prometheus.Metric, exposeStats bool) {
+	t.restarts.Collect(ch)
+	if !exposeStats || !t.seeded {
+		return
+	}
+	t.startTime.Collect(ch)
+	for _, counter := range t.stitched {
+		if counter.seen {
+			ch <- prometheus.MustNewConstMetric(counter.desc, prometheus.CounterValue, counter.offset+counter.last)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+func TestRestartTrackerObserve(t *testing.T) {
+	tracker := newRestartTracker([]string{"cmd_put_total", "current_jobs_ready_count"}, true)
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		num                 string
+		stats               beanstalkd.ServerStats
+		now                 time.Time
+		expectedRestarted   bool
+		expectedRestarts    float64
+		expectedStartTime   float64
+		expectedStitchedPut float64
+	}{
+		// We expect the first observation to only seed the tracker.
+		{
+			num:                 "1) ",
+			stats:               beanstalkd.ServerStats{"pid": "1", "uptime": "100", "cmd-put": "10"},
+			now:                 start,
+			expectedRestarted:   false,
+			expectedRestarts:    0,
+			expectedStartTime:   1700000000 - 100,
+			expectedStitchedPut: 10,
+		},
+		// We expect no restart while the uptime increases.
+		{
+			num:                 "2) ",
+			stats:               beanstalkd.ServerStats{"pid": "1", "uptime": "160", "cmd-put": "15"},
+			now:                 start.Add(time.Minute),
+			expectedRestarted:   false,
+			expectedRestarts:    0,
+			expectedStartTime:   1700000000 - 100,
+			expectedStitchedPut: 15,
+		},
+		// We expect a restart when the uptime is lower.
+		{
+			num:                 "3) ",
+			stats:               beanstalkd.ServerStats{"pid": "1", "uptime": "5", "cmd-put": "2"},
+			now:                 start.Add(2 * time.Minute),
+			expectedRestarted:   true,
+			expectedRestarts:    1,
+			expectedStartTime:   1700000000 + 115,
+			expectedStitchedPut: 17,
+		},
+		// We expect a restart when the pid changes.
+		{
+			num:                 "4) ",
+			stats:               beanstalkd.ServerStats{"pid": "2", "uptime": "600", "cmd-put": "1"},
+			now:                 start.Add(3 * time.Minute),
+			expectedRestarted:   true,
+			expectedRestarts:    2,
+			expectedStartTime:   1700000000 - 420,
+			expectedStitchedPut: 18,
+		},
+		// We expect stats without an uptime to be ignored.
+		{
+			num:                 "5) ",
+			stats:               beanstalkd.ServerStats{"cmd-put": "0"},
+			now:                 start.Add(4 * time.Minute),
+			expectedRestarted:   false,
+			expectedRestarts:    2,
+			expectedStartTime:   1700000000 - 420,
+			expectedStitchedPut: 18,
+		},
+	}
+
+	for _, tt := range tests {
+		if actual := tracker.observe(tt.stats, tt.now); tt.expectedRestarted != actual {
+			t.Errorf(tt.num+"expected restarted %v, actual %v", tt.expectedRestarted, actual)
+		}
+		if actual := readCounter(tracker.restarts); tt.expectedRestarts != actual {
+			t.Errorf(tt.num+"expected %v restarts, actual %v", tt.expectedRestarts, actual)
+		}
+		if actual := readGauge(tracker.startTime); tt.expectedStartTime != actual {
+			t.Errorf(tt.num+"expected start time %v, actual %v", tt.expectedStartTime, actual)
+		}
+		put := tracker.stitched["cmd-put"]
+		if actual := put.offset + put.last; tt.expectedStitchedPut != actual {
+			t.Errorf(tt.num+"expected stitched puts %v, actual %v", tt.expectedStitchedPut, actual)
+		}
+	}
+
+	// We expect only the cumulative system metrics to be stitched.
+	if expected, actual := 1, len(tracker.stitched); expected != actual {
+		t.Errorf("expected %v stitched metrics, actual %v", expected, actual)
+	}
+}
+
+func TestRestartTrackerWithoutStitching(t *testing.T) {
+	tracker := newRestartTracker([]string{"cmd_put_total"}, false)
+	if expected, actual := 0, len(tracker.stitched); expected != actual {
+		t.Errorf("expected %v stitched metrics, actual %v", expected, actual)
+	}
+}
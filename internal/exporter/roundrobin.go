@@ -0,0 +1,107 @@
+package exporter
+
+import (
+	"sort"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+// cachedTubeStats are the most recent stats fetched for a tube.
+type cachedTubeStats struct {
+	stats     beanstalkd.TubeStats
+	fetchedAt time.Time
+}
+
+// roundRobin returns true when each scrape only fetches
+// some of the tubes, rotating through all of them.
+func (opts *CollectorOpts) roundRobin() bool {
+	return opts.TubesPerScrape > 0 || opts.TubesScrapeBudget > 0
+}
+
+// nextTubes returns up to n tubes, in name order, starting with
+// the tube after cursor and wrapping around to the first tube.
+// All of the tubes are returned when n is zero.
+func nextTubes(tubes []string, cursor string, n int) []string {
+	sorted := make([]string, len(tubes))
+	copy(sorted, tubes)
+	sort.Strings(sorted)
+
+	if n <= 0 || n > len(sorted) {
+		n = len(sorted)
+	}
+	start := sort.Search(len(sorted), func(i int) bool {
+		return sorted[i] > cursor
+	})
+	next := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		next = append(next, sorted[(start+i)%len(sorted)])
+	}
+	return next
+}
+
+// lastTube returns the last of the tubes, in name order.
+func lastTube(tubes []string) string {
+	last := tubes[0]
+	for _, tube := range tubes[1:] {
+		if tube > last {
+			last = tube
+		}
+	}
+	return last
+}
+
+// fetchTubesStats fetches the stats for the tubes to scrape. When
+// scraping in round-robin mode, only the next tubes in the rotation
+// are fetched, for as long as the scrape budget allows. The result
+// is the set of tubes that were fetched (whether or not they exist),
+// and their stats.
+func (b *BeanstalkdCollector) fetchTubesStats(tubeNames []string) (map[string]bool, beanstalkd.ManyTubeStats, error) {
+
+	if !b.opts.roundRobin() {
+		fetched := make(map[string]bool, len(tubeNames))
+		for _, tube := range tubeNames {
+			fetched[tube] = true
+		}
+		manyTubesStats, err := b.beanstalkd.FetchTubesStats(fetched)
+		return fetched, manyTubesStats, err
+	}
+
+	batch := nextTubes(tubeNames, b.tubeCursor, b.opts.TubesPerScrape)
+
+	if b.opts.TubesScrapeBudget == 0 {
+		fetched := make(map[string]bool, len(batch))
+		for _, tube := range batch {
+			fetched[tube] = true
+		}
+		manyTubesStats, err := b.beanstalkd.FetchTubesStats(fetched)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(batch) > 0 {
+			b.tubeCursor = batch[len(batch)-1]
+		}
+		return fetched, manyTubesStats, nil
+	}
+
+	// Fetch one tube at a time until the budget is spent,
+	// making sure that at least one tube is fetched.
+	start := b.now()
+	fetched := make(map[string]bool)
+	manyTubesStats := make(beanstalkd.ManyTubeStats)
+	for _, tube := range batch {
+		if len(fetched) > 0 && b.now().Sub(start) >= b.opts.TubesScrapeBudget {
+			break
+		}
+		tubeStats, err := b.beanstalkd.FetchTubesStats(map[string]bool{tube: true})
+		if err != nil {
+			return nil, nil, err
+		}
+		fetched[tube] = true
+		b.tubeCursor = tube
+		for t, statsOrErr := range tubeStats {
+			manyTubesStats[t] = statsOrErr
+		}
+	}
+	return fetched, manyTubesStats, nil
+}
@@ -0,0 +1,184 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+func TestNextTubes(t *testing.T) {
+	tubes := []string{"c", "a", "d", "b"}
+
+	tests := []struct {
+		cursor   string
+		n        int
+		expected []string
+	}{
+		// We expect all tubes, in order, when there's no limit.
+		{cursor: "", n: 0, expected: []string{"a", "b", "c", "d"}},
+		// We expect to start at the beginning without a cursor.
+		{cursor: "", n: 2, expected: []string{"a", "b"}},
+		// We expect to start after the cursor.
+		{cursor: "b", n: 2, expected: []string{"c", "d"}},
+		// We expect to wrap around to the first tube.
+		{cursor: "c", n: 2, expected: []string{"d", "a"}},
+		{cursor: "d", n: 2, expected: []string{"a", "b"}},
+		// We expect to start after a cursor that no longer exists.
+		{cursor: "bb", n: 1, expected: []string{"c"}},
+		// We expect each tube at most once.
+		{cursor: "c", n: 10, expected: []string{"d", "a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		actual := nextTubes(tubes, tt.cursor, tt.n)
+		if !reflect.DeepEqual(tt.expected, actual) {
+			t.Errorf("expected %v for cursor %q and n %v, actual %v", tt.expected, tt.cursor, tt.n, actual)
+		}
+	}
+
+	if actual := nextTubes(nil, "", 2); len(actual) != 0 {
+		t.Errorf("expected no tubes, actual %v", actual)
+	}
+}
+
+func TestRoundRobinTubesPerScrape(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	server := mockHealthyBeanstalkd()
+	collector, err := NewBeanstalkdCollector(
+		server,
+		CollectorOpts{
+			SystemMetrics:  []string{"current_jobs_ready_count"},
+			AllTubes:       true,
+			TubeMetrics:    []string{"tube_current_jobs_ready_count"},
+			TubesPerScrape: 1,
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	collector.now = func() time.Time { return now }
+
+	tests := []struct {
+		num                  string
+		expectedFetched      []string
+		expectedDefaultAge   float64
+		expectedAnotherAge   float64
+		expectedDefaultReady float64
+	}{
+		{num: "1) ", expectedFetched: []string{"anotherTube"}, expectedAnotherAge: 0},
+		{num: "2) ", expectedFetched: []string{"default"}, expectedDefaultAge: 0, expectedAnotherAge: 10, expectedDefaultReady: 10},
+		{num: "3) ", expectedFetched: []string{"anotherTube"}, expectedDefaultAge: 10, expectedAnotherAge: 0, expectedDefaultReady: 10},
+	}
+
+	for _, tt := range tests {
+		server.fetchedTubes = nil
+		collector.resetMetrics()
+		collector.scrape()
+
+		if !reflect.DeepEqual([][]string{tt.expectedFetched}, server.fetchedTubes) {
+			t.Errorf(tt.num+"expected fetched tubes %v, actual %v", tt.expectedFetched, server.fetchedTubes)
+		}
+		if expected, actual := 1., readGauge(collector.up); expected != actual {
+			t.Errorf(tt.num+"expected 'up' value %v, actual %v", expected, actual)
+		}
+		// We expect the most recent stats for tubes that weren't fetched.
+		ready := collector.tubesMetrics["current-jobs-ready"]
+		if expected, actual := 2., readGauge(ready.WithLabelValues("anotherTube")); expected != actual {
+			t.Errorf(tt.num+"expected 'anotherTube' ready %v, actual %v", expected, actual)
+		}
+		if tt.expectedDefaultReady > 0 {
+			if expected, actual := tt.expectedDefaultReady, readGauge(ready.WithLabelValues("default")); expected != actual {
+				t.Errorf(tt.num+"expected 'default' ready %v, actual %v", expected, actual)
+			}
+			if expected, actual := tt.expectedDefaultAge, readGauge(collector.tubeStatsAge.WithLabelValues("default")); expected != actual {
+				t.Errorf(tt.num+"expected 'default' age %v, actual %v", expected, actual)
+			}
+		}
+		if expected, actual := tt.expectedAnotherAge, readGauge(collector.tubeStatsAge.WithLabelValues("anotherTube")); expected != actual {
+			t.Errorf(tt.num+"expected 'anotherTube' age %v, actual %v", expected, actual)
+		}
+
+		now = now.Add(10 * time.Second)
+	}
+}
+
+func TestRoundRobinTubeTracking(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	collector, err := NewBeanstalkdCollector(
+		mockHealthyBeanstalkd(),
+		CollectorOpts{
+			AllTubes:       true,
+			TubesPerScrape: 1,
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	collector.now = func() time.Time { return now }
+
+	// We expect the tubes fetched later in the first rotation
+	// not to be counted as created, as they existed all along.
+	tests := []struct {
+		num             string
+		expectedTracked int
+	}{
+		{num: "1) ", expectedTracked: 0},
+		{num: "2) ", expectedTracked: 2},
+		{num: "3) ", expectedTracked: 2},
+	}
+	for _, tt := range tests {
+		collector.scrape()
+		if expected, actual := 0., readCounter(collector.tubeTracker.created); expected != actual {
+			t.Errorf(tt.num+"expected %v tubes created, actual %v", expected, actual)
+		}
+		if actual := len(collector.tubeTracker.firstSeen); tt.expectedTracked != actual {
+			t.Errorf(tt.num+"expected %v tubes tracked, actual %v", tt.expectedTracked, actual)
+		}
+		now = now.Add(10 * time.Second)
+	}
+}
+
+func TestRoundRobinTubesScrapeBudget(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	server := mockHealthyBeanstalkd()
+	server.listTubes = []string{"default", "anotherTube", "third"}
+	server.tubesStats["third"] = beanstalkd.TubeStatsOrError{
+		Stats: beanstalkd.TubeStats{"current-jobs-ready": "3"},
+	}
+	collector, err := NewBeanstalkdCollector(
+		server,
+		CollectorOpts{
+			AllTubes:          true,
+			TubesScrapeBudget: 2 * time.Second,
+		},
+		mockLogger(),
+	)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	// Every look at the clock takes a second.
+	collector.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	collector.scrape()
+	expected := [][]string{{"anotherTube"}, {"default"}}
+	if !reflect.DeepEqual(expected, server.fetchedTubes) {
+		t.Errorf("expected fetched tubes %v, actual %v", expected, server.fetchedTubes)
+	}
+
+	server.fetchedTubes = nil
+	collector.scrape()
+	expected = [][]string{{"third"}, {"anotherTube"}}
+	if !reflect.DeepEqual(expected, server.fetchedTubes) {
+		t.Errorf("expected fetched tubes %v, actual %v", expected, server.fetchedTubes)
+	}
+	if expected, actual := 3, len(collector.tubeStats); expected != actual {
+		t.Errorf("expected %v cached tubes, actual %v", expected, actual)
+	}
+}
@@ -0,0 +1,279 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The comparisons of a rule's stat with its threshold.
+const (
+	RuleAbove = ">"
+	RuleBelow = "<"
+)
+
+// The statuses of a rule notification.
+const (
+	RuleFiring   = "firing"
+	RuleResolved = "resolved"
+)
+
+// Rule is a threshold on a system stat, or a tube stat when it has a
+// tube. The rule fires when the stat has been beyond the threshold for
+// the For duration, and resolves when the stat is back within the
+// Resolve threshold (the threshold by default), so that a stat that
+// hovers around the threshold doesn't keep firing and resolving. The
+// severity and annotations are passed on in the notifications.
+type Rule struct {
+	Name        string            `json:"name"`
+	Tube        string            `json:"tube,omitempty"`
+	Stat        string            `json:"stat"`
+	Op          string            `json:"op"`
+	Threshold   float64           `json:"threshold"`
+	Resolve     *float64          `json:"resolve,omitempty"`
+	For         Duration          `json:"for,omitempty"`
+	Severity    string            `json:"severity,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Duration is a time.Duration read from JSON as a string, like "5m".
+type Duration time.Duration
+
+// UnmarshalJSON reads the duration from a string, like "5m".
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LoadRules reads the rules from a JSON file, as a list of rules.
+func LoadRules(path string) ([]Rule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("invalid rules file %v: %v", path, err)
+	}
+	return rules, nil
+}
+
+// validateRules returns an error for the first invalid rule.
+func validateRules(rules []Rule, allTubes bool, tubes []string) error {
+	names := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule without a name")
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate rule: %v", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Stat == "" {
+			return fmt.Errorf("rule %v without a stat", rule.Name)
+		}
+		if rule.Tube != "" && !allTubes && !slices.Contains(tubes, rule.Tube) {
+			return fmt.Errorf("rule %v of a tube that isn't scraped: %v", rule.Name, rule.Tube)
+		}
+		switch rule.Op {
+		case RuleAbove:
+			if rule.Resolve != nil && *rule.Resolve > rule.Threshold {
+				return fmt.Errorf("rule %v resolve > threshold", rule.Name)
+			}
+		case RuleBelow:
+			if rule.Resolve != nil && *rule.Resolve < rule.Threshold {
+				return fmt.Errorf("rule %v resolve < threshold", rule.Name)
+			}
+		default:
+			return fmt.Errorf("rule %v has an unknown op: %v", rule.Name, rule.Op)
+		}
+		if rule.For < 0 {
+			return fmt.Errorf("rule %v for < 0", rule.Name)
+		}
+	}
+	return nil
+}
+
+// RuleNotification is sent when a rule fires or resolves.
+type RuleNotification struct {
+	Rule        string            `json:"rule"`
+	Status      string            `json:"status"`
+	Tube        string            `json:"tube,omitempty"`
+	Stat        string            `json:"stat"`
+	Value       float64           `json:"value"`
+	Threshold   float64           `json:"threshold"`
+	Severity    string            `json:"severity,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Since       time.Time         `json:"since"`
+	At          time.Time         `json:"at"`
+}
+
+// RuleNotifier is sent the notifications of the rules. Notify mustn't
+// block the scrape that evaluated the rules.
+type RuleNotifier interface {
+	Notify(RuleNotification)
+}
+
+// ruleState is the state of a rule across scrapes. A rule is pending
+// while its stat is beyond the threshold, until it fires.
+type ruleState struct {
+	pendingSince time.Time
+	firing       bool
+	value        float64
+}
+
+// ruleEngine evaluates the rules on each scrape, and notifies
+// the notifiers when they fire or resolve.
+type ruleEngine struct {
+	rules     []Rule
+	states    []ruleState
+	notifiers []RuleNotifier
+
+	firing *prometheus.GaugeVec
+}
+
+func newRuleEngine(rules []Rule, notifiers []RuleNotifier) *ruleEngine {
+	e := &ruleEngine{
+		rules:     rules,
+		states:    make([]ruleState, len(rules)),
+		notifiers: notifiers,
+		firing: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "exporter_rule_firing",
+			Help:      "Whether the rule is firing (1 = firing, 0 = not firing).",
+		}, []string{"rule"}),
+	}
+	for _, rule := range rules {
+		e.firing.WithLabelValues(rule.Name).Set(0)
+	}
+	return e
+}
+
+// evaluate evaluates the rules against the stats of a scrape. A rule
+// of a tube in maintenance (or of beanstalkd, for the system stats)
+// is suppressed, and a rule whose stat isn't in the stats (like when
+// its tube no longer exists) can't be evaluated, so both are reset,
+// resolving when they're firing.
+func (e *ruleEngine) evaluate(systemStats beanstalkd.ServerStats, tubeStats map[string]cachedTubeStats, now time.Time, inMaintenance func(tube string) bool) {
+	for i, rule := range e.rules {
+		state := &e.states[i]
+		if inMaintenance(rule.Tube) {
+			e.reset(i, now)
+			continue
+		}
+
+		var stat string
+		var ok bool
+		if rule.Tube == "" {
+			stat, ok = systemStats[rule.Stat]
+		} else {
+			stat, ok = tubeStats[rule.Tube].stats[rule.Stat]
+		}
+		value, err := strconv.ParseFloat(stat, 64)
+		if !ok || err != nil {
+			e.reset(i, now)
+			continue
+		}
+
+		state.value = value
+		switch {
+		case state.firing && rule.resolved(value):
+			state.firing = false
+			e.notify(rule, RuleResolved, value, state.pendingSince, now)
+			state.pendingSince = time.Time{}
+		case state.firing:
+		case !rule.breached(value):
+			state.pendingSince = time.Time{}
+		default:
+			if state.pendingSince.IsZero() {
+				state.pendingSince = now
+			}
+			if now.Sub(state.pendingSince) >= time.Duration(rule.For) {
+				state.firing = true
+				e.notify(rule, RuleFiring, value, state.pendingSince, now)
+			}
+		}
+		e.firing.WithLabelValues(rule.Name).Set(boolToFloat(state.firing))
+	}
+}
+
+// reset resets the state of a rule, resolving it when it's firing.
+func (e *ruleEngine) reset(i int, now time.Time) {
+	rule, state := e.rules[i], &e.states[i]
+	if state.firing {
+		state.firing = false
+		e.notify(rule, RuleResolved, state.value, state.pendingSince, now)
+	}
+	state.pendingSince = time.Time{}
+	e.firing.WithLabelValues(rule.Name).Set(0)
+}
+
+// breached returns true when the value is beyond the threshold.
+func (r Rule) breached(value float64) bool {
+	if r.Op == RuleBelow {
+		return value < r.Threshold
+	}
+	return value > r.Threshold
+}
+
+// resolved returns true when the value is back within the
+// resolve threshold.
+func (r Rule) resolved(value float64) bool {
+	threshold := r.Threshold
+	if r.Resolve != nil {
+		threshold = *r.Resolve
+	}
+	if r.Op == RuleBelow {
+		return value >= threshold
+	}
+	return value <= threshold
+}
+
+func (e *ruleEngine) notify(rule Rule, status string, value float64, since, now time.Time) {
+	notification := RuleNotification{
+		Rule:        rule.Name,
+		Status:      status,
+		Tube:        rule.Tube,
+		Stat:        rule.Stat,
+		Value:       value,
+		Threshold:   rule.Threshold,
+		Severity:    rule.Severity,
+		Annotations: rule.Annotations,
+		Since:       since,
+		At:          now,
+	}
+	for _, notifier := range e.notifiers {
+		notifier.Notify(notification)
+	}
+}
+
+func (e *ruleEngine) describe(ch chan<- *prometheus.Desc) {
+	e.firing.Describe(ch)
+}
+
+func (e *ruleEngine) collect(ch chan<- prometheus.Metric) {
+	e.firing.Collect(ch)
+}
+
+// evaluateRules evaluates the rules (if any) against the stats
+// of a successful scrape.
+func (b *BeanstalkdCollector) evaluateRules() {
+	if b.rules == nil {
+		return
+	}
+	b.rules.evaluate(b.systemStats, b.tubeStats, b.now(), b.inMaintenance)
+}
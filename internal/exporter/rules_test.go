@@ -0,0 +1,182 @@
+package exporter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	err := os.WriteFile(path, []byte(`[
+		{"name": "emails_backlog", "tube": "emails", "stat": "current-jobs-ready", "op": ">", "threshold": 1000, "resolve": 800, "for": "5m"},
+		{"name": "no_workers", "stat": "current-workers", "op": "<", "threshold": 1}
+	]`), 0o600)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	resolve := 800.0
+	expected := []Rule{
+		{Name: "emails_backlog", Tube: "emails", Stat: "current-jobs-ready", Op: RuleAbove, Threshold: 1000, Resolve: &resolve, For: Duration(5 * time.Minute)},
+		{Name: "no_workers", Stat: "current-workers", Op: RuleBelow, Threshold: 1},
+	}
+	if !reflect.DeepEqual(expected, rules) {
+		t.Errorf("expected %v, actual %v", expected, rules)
+	}
+
+	// We expect an error for an invalid duration.
+	if err := os.WriteFile(path, []byte(`[{"name": "a", "stat": "b", "op": ">", "for": "soon"}]`), 0o600); err != nil {
+		t.Fatalf("expected nil error, actual %v", err)
+	}
+	if _, err := LoadRules(path); err == nil {
+		t.Error("expected error, actual nil")
+	}
+}
+
+func TestRuleEngine(t *testing.T) {
+	resolve := 80.0
+	notifier := &mockRuleNotifier{}
+	engine := newRuleEngine([]Rule{
+		{Name: "backlog", Tube: "default", Stat: "current-jobs-ready", Op: RuleAbove, Threshold: 100, Resolve: &resolve, For: Duration(2 * time.Minute)},
+		{Name: "no_workers", Stat: "current-workers", Op: RuleBelow, Threshold: 1},
+	}, []RuleNotifier{notifier})
+	start := time.Now()
+
+	tests := []struct {
+		num                   string
+		minutes               int
+		ready                 string
+		workers               string
+		expectedBacklog       float64
+		expectedNoWorkers     float64
+		expectedNotifications []string
+	}{
+		// We expect a rule without a for duration to fire straight away.
+		{num: "1) ", minutes: 0, ready: "50", workers: "0", expectedBacklog: 0, expectedNoWorkers: 1, expectedNotifications: []string{"no_workers firing"}},
+		// We expect a rule to be pending during its for duration.
+		{num: "2) ", minutes: 1, ready: "150", workers: "0", expectedBacklog: 0, expectedNoWorkers: 1},
+		{num: "3) ", minutes: 2, ready: "150", workers: "1", expectedBacklog: 0, expectedNoWorkers: 0, expectedNotifications: []string{"no_workers resolved"}},
+		{num: "4) ", minutes: 3, ready: "150", workers: "1", expectedBacklog: 1, expectedNoWorkers: 0, expectedNotifications: []string{"backlog firing"}},
+		// We expect a rule within the threshold, but beyond the resolve threshold, to keep firing.
+		{num: "5) ", minutes: 4, ready: "90", workers: "1", expectedBacklog: 1, expectedNoWorkers: 0},
+		// We expect a firing rule to resolve when its tube disappears.
+		{num: "6) ", minutes: 5, workers: "1", expectedBacklog: 0, expectedNoWorkers: 0, expectedNotifications: []string{"backlog resolved"}},
+		// We expect a rule to be pending again when its tube comes back.
+		{num: "7) ", minutes: 6, ready: "150", workers: "1", expectedBacklog: 0, expectedNoWorkers: 0},
+		// We expect a rule that's no longer beyond the threshold to no longer be pending.
+		{num: "8) ", minutes: 7, ready: "150", workers: "1", expectedBacklog: 0, expectedNoWorkers: 0},
+		{num: "9) ", minutes: 8, ready: "50", workers: "1", expectedBacklog: 0, expectedNoWorkers: 0},
+		{num: "10) ", minutes: 9, ready: "150", workers: "1", expectedBacklog: 0, expectedNoWorkers: 0},
+	}
+	for _, tt := range tests {
+		notifier.notifications = nil
+		tubeStats := map[string]cachedTubeStats{}
+		if tt.ready != "" {
+			tubeStats["default"] = cachedTubeStats{stats: beanstalkd.TubeStats{"current-jobs-ready": tt.ready}}
+		}
+		engine.evaluate(beanstalkd.ServerStats{"current-workers": tt.workers}, tubeStats, start.Add(time.Duration(tt.minutes)*time.Minute), noMaintenance)
+
+		if actual := readGauge(engine.firing.WithLabelValues("backlog")); tt.expectedBacklog != actual {
+			t.Errorf(tt.num+"expected backlog %v, actual %v", tt.expectedBacklog, actual)
+		}
+		if actual := readGauge(engine.firing.WithLabelValues("no_workers")); tt.expectedNoWorkers != actual {
+			t.Errorf(tt.num+"expected no workers %v, actual %v", tt.expectedNoWorkers, actual)
+		}
+		var actual []string
+		for _, n := range notifier.notifications {
+			actual = append(actual, n.Rule+" "+n.Status)
+		}
+		if !reflect.DeepEqual(tt.expectedNotifications, actual) {
+			t.Errorf(tt.num+"expected notifications %v, actual %v", tt.expectedNotifications, actual)
+		}
+	}
+}
+
+func TestRuleNotification(t *testing.T) {
+	notifier := &mockRuleNotifier{}
+	engine := newRuleEngine([]Rule{
+		{Name: "backlog", Tube: "default", Stat: "current-jobs-ready", Op: RuleAbove, Threshold: 100, For: Duration(time.Minute)},
+	}, []RuleNotifier{notifier})
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		engine.evaluate(nil, map[string]cachedTubeStats{
+			"default": {stats: beanstalkd.TubeStats{"current-jobs-ready": "150"}},
+		}, start.Add(time.Duration(i)*time.Minute), noMaintenance)
+	}
+
+	expected := []RuleNotification{
+		{
+			Rule:      "backlog",
+			Status:    RuleFiring,
+			Tube:      "default",
+			Stat:      "current-jobs-ready",
+			Value:     150,
+			Threshold: 100,
+			Since:     start,
+			At:        start.Add(time.Minute),
+		},
+	}
+	if !reflect.DeepEqual(expected, notifier.notifications) {
+		t.Errorf("expected %v, actual %v", expected, notifier.notifications)
+	}
+}
+
+func TestRuleTubeDisappears(t *testing.T) {
+	notifier := &mockRuleNotifier{}
+	engine := newRuleEngine([]Rule{
+		{Name: "backlog", Tube: "default", Stat: "current-jobs-ready", Op: RuleAbove, Threshold: 100},
+	}, []RuleNotifier{notifier})
+	start := time.Now()
+	engine.evaluate(nil, map[string]cachedTubeStats{
+		"default": {stats: beanstalkd.TubeStats{"current-jobs-ready": "150"}},
+	}, start, noMaintenance)
+
+	// We expect the firing rule to resolve, with its last value,
+	// when its tube disappears.
+	notifier.notifications = nil
+	engine.evaluate(nil, map[string]cachedTubeStats{}, start.Add(time.Minute), noMaintenance)
+	expected := []RuleNotification{
+		{
+			Rule:      "backlog",
+			Status:    RuleResolved,
+			Tube:      "default",
+			Stat:      "current-jobs-ready",
+			Value:     150,
+			Threshold: 100,
+			Since:     start,
+			At:        start.Add(time.Minute),
+		},
+	}
+	if !reflect.DeepEqual(expected, notifier.notifications) {
+		t.Errorf("expected %v, actual %v", expected, notifier.notifications)
+	}
+	if expected, actual := 0., readGauge(engine.firing.WithLabelValues("backlog")); expected != actual {
+		t.Errorf("expected firing %v, actual %v", expected, actual)
+	}
+
+	// We expect it to stay resolved while its tube doesn't exist.
+	notifier.notifications = nil
+	engine.evaluate(nil, map[string]cachedTubeStats{}, start.Add(2*time.Minute), noMaintenance)
+	if len(notifier.notifications) > 0 {
+		t.Errorf("expected no notifications, actual %v", notifier.notifications)
+	}
+}
+
+/********************     MOCKS     ********************/
+
+type mockRuleNotifier struct {
+	notifications []RuleNotification
+}
+
+func (m *mockRuleNotifier) Notify(notification RuleNotification) {
+	m.notifications = append(m.notifications, notification)
+}
@@ -0,0 +1,106 @@
+package exporter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultStalledScrapes = 5
+
+	// stalledNoWatchers is when a tube has ready jobs,
+	// but no consumers watching it.
+	stalledNoWatchers = "no_watchers"
+	// stalledNoDeletes is when a tube's ready jobs are growing,
+	// but no jobs have been deleted for a number of scrapes.
+	stalledNoDeletes = "no_deletes"
+)
+
+// stallHistory is what's been seen of a tube's
+// deletes and ready jobs across scrapes.
+type stallHistory struct {
+	deletes          int64
+	readyAtLastMove  int64
+	unchangedScrapes int
+}
+
+// stallDetector flags tubes whose consumers appear to be gone.
+type stallDetector struct {
+	scrapes int
+	history map[string]*stallHistory
+
+	stalled *prometheus.GaugeVec
+}
+
+func newStallDetector(scrapes int) *stallDetector {
+	return &stallDetector{
+		scrapes: scrapes,
+		history: make(map[string]*stallHistory),
+		stalled: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_stalled",
+			Help:      "Whether the tube appears to be stalled, by reason (1 = stalled, 0 = not stalled).",
+		}, []string{"tube", "reason"}),
+	}
+}
+
+// observe checks the most recent stats of each tube, replacing the
+// metrics of previous scrapes. The history of a tube only moves on
+// when its stats were fetched in this scrape. Tubes in maintenance
+// aren't flagged as stalled.
+func (d *stallDetector) observe(tubeStats map[string]cachedTubeStats, now time.Time, inMaintenance func(tube string) bool) {
+	d.stalled.Reset()
+	for tube := range d.history {
+		if _, ok := tubeStats[tube]; !ok {
+			delete(d.history, tube)
+		}
+	}
+
+	for tube, cached := range tubeStats {
+		ready, readyErr := strconv.ParseInt(cached.stats["current-jobs-ready"], 10, 64)
+		watching, watchingErr := strconv.ParseInt(cached.stats["current-watching"], 10, 64)
+		deletes, deletesErr := strconv.ParseInt(cached.stats["cmd-delete"], 10, 64)
+		if readyErr != nil || watchingErr != nil || deletesErr != nil {
+			continue
+		}
+
+		h, seen := d.history[tube]
+		if !seen {
+			h = &stallHistory{deletes: deletes, readyAtLastMove: ready}
+			d.history[tube] = h
+		} else if cached.fetchedAt.Equal(now) {
+			if deletes != h.deletes {
+				h.deletes = deletes
+				h.readyAtLastMove = ready
+				h.unchangedScrapes = 0
+			} else {
+				h.unchangedScrapes++
+			}
+		}
+
+		suppressed := inMaintenance(tube)
+		d.stalled.WithLabelValues(tube, stalledNoWatchers).Set(boolToFloat(
+			!suppressed && ready > 0 && watching == 0,
+		))
+		d.stalled.WithLabelValues(tube, stalledNoDeletes).Set(boolToFloat(
+			!suppressed && h.unchangedScrapes >= d.scrapes && ready > h.readyAtLastMove,
+		))
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (d *stallDetector) describe(ch chan<- *prometheus.Desc) {
+	d.stalled.Describe(ch)
+}
+
+func (d *stallDetector) collect(ch chan<- prometheus.Metric) {
+	d.stalled.Collect(ch)
+}
@@ -0,0 +1,94 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+func TestStallDetector(t *testing.T) {
+	detector := newStallDetector(2)
+	start := time.Now()
+
+	scrape := func(i int, ready, watching, deletes string) {
+		now := start.Add(time.Duration(i) * time.Minute)
+		detector.observe(map[string]cachedTubeStats{
+			"default": {
+				stats: beanstalkd.TubeStats{
+					"current-jobs-ready": ready,
+					"current-watching":   watching,
+					"cmd-delete":         deletes,
+				},
+				fetchedAt: now,
+			},
+		}, now, noMaintenance)
+	}
+
+	tests := []struct {
+		num                string
+		ready              string
+		watching           string
+		deletes            string
+		expectedNoWatchers float64
+		expectedNoDeletes  float64
+	}{
+		// We expect a tube with ready jobs and watchers not to be stalled.
+		{num: "1) ", ready: "10", watching: "1", deletes: "100", expectedNoWatchers: 0, expectedNoDeletes: 0},
+		// We expect a tube with ready jobs and no watchers to be stalled, and a tube
+		// without deletes for fewer scrapes than the limit not to be stalled.
+		{num: "2) ", ready: "11", watching: "0", deletes: "100", expectedNoWatchers: 1, expectedNoDeletes: 0},
+		// We expect a tube whose ready jobs have grown without deletes for the limit to be stalled.
+		{num: "3) ", ready: "12", watching: "1", deletes: "100", expectedNoWatchers: 0, expectedNoDeletes: 1},
+		{num: "4) ", ready: "15", watching: "1", deletes: "100", expectedNoWatchers: 0, expectedNoDeletes: 1},
+		// We expect a tube with deletes not to be stalled.
+		{num: "5) ", ready: "20", watching: "1", deletes: "101", expectedNoWatchers: 0, expectedNoDeletes: 0},
+		// We expect a tube without deletes, whose ready jobs haven't grown, not to be stalled.
+		{num: "6) ", ready: "20", watching: "1", deletes: "101", expectedNoWatchers: 0, expectedNoDeletes: 0},
+		{num: "7) ", ready: "20", watching: "1", deletes: "101", expectedNoWatchers: 0, expectedNoDeletes: 0},
+		// We expect an empty tube without watchers not to be stalled.
+		{num: "8) ", ready: "0", watching: "0", deletes: "101", expectedNoWatchers: 0, expectedNoDeletes: 0},
+	}
+	for i, tt := range tests {
+		scrape(i, tt.ready, tt.watching, tt.deletes)
+		if actual := readGauge(detector.stalled.WithLabelValues("default", stalledNoWatchers)); tt.expectedNoWatchers != actual {
+			t.Errorf(tt.num+"expected no watchers %v, actual %v", tt.expectedNoWatchers, actual)
+		}
+		if actual := readGauge(detector.stalled.WithLabelValues("default", stalledNoDeletes)); tt.expectedNoDeletes != actual {
+			t.Errorf(tt.num+"expected no deletes %v, actual %v", tt.expectedNoDeletes, actual)
+		}
+	}
+}
+
+func TestStallDetectorCachedStats(t *testing.T) {
+	detector := newStallDetector(1)
+	fetchedAt := time.Now()
+	stats := map[string]cachedTubeStats{
+		"default": {
+			stats: beanstalkd.TubeStats{
+				"current-jobs-ready": "10",
+				"current-watching":   "1",
+				"cmd-delete":         "100",
+			},
+			fetchedAt: fetchedAt,
+		},
+	}
+	detector.observe(stats, fetchedAt, noMaintenance)
+
+	// We expect stats cached from a previous scrape not to count as a scrape without deletes.
+	for i := 1; i <= 3; i++ {
+		detector.observe(stats, fetchedAt.Add(time.Duration(i)*time.Minute), noMaintenance)
+	}
+	if expected, actual := 0, detector.history["default"].unchangedScrapes; expected != actual {
+		t.Errorf("expected %v unchanged scrapes, actual %v", expected, actual)
+	}
+
+	// We expect the tubes that are no longer scraped to be forgotten.
+	detector.observe(map[string]cachedTubeStats{}, fetchedAt.Add(5*time.Minute), noMaintenance)
+	if expected, actual := 0, len(detector.history); expected != actual {
+		t.Errorf("expected %v tubes, actual %v", expected, actual)
+	}
+	if expected, actual := 0, len(collectAll(detector.stalled)); expected != actual {
+		t.Errorf("expected %v metrics, actual %v", expected, actual)
+	}
+}
@@ -0,0 +1,132 @@
+package exporter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// throughputSnapshot is what's been seen of a tube's
+// cumulative stats in a scrape.
+type throughputSnapshot struct {
+	puts      float64
+	deletes   float64
+	fetchedAt time.Time
+}
+
+// throughputTracker derives rates from the cumulative stats of each
+// tube, for consumers of the metrics that can't compute them. The
+// rates are between the two most recent fetches of a tube's stats.
+type throughputTracker struct {
+	previous map[string]throughputSnapshot
+
+	putRate       *prometheus.GaugeVec
+	deleteRate    *prometheus.GaugeVec
+	backlogGrowth *prometheus.GaugeVec
+	drainTime     *prometheus.GaugeVec
+}
+
+func newThroughputTracker() *throughputTracker {
+	return &throughputTracker{
+		previous: make(map[string]throughputSnapshot),
+		putRate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_put_rate_per_second",
+			Help:      "The number of jobs put per second into this tube, between the two most recent scrapes of the tube.",
+		}, []string{"tube"}),
+		deleteRate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_delete_rate_per_second",
+			Help:      "The number of jobs deleted per second from this tube, between the two most recent scrapes of the tube.",
+		}, []string{"tube"}),
+		backlogGrowth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_backlog_growth_per_second",
+			Help:      "The put rate less the delete rate for this tube, between the two most recent scrapes of the tube.",
+		}, []string{"tube"}),
+		drainTime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tube_estimated_drain_seconds",
+			Help:      "The estimated number of seconds to delete the ready jobs of this tube, at the current delete rate.",
+		}, []string{"tube"}),
+	}
+}
+
+// observe derives the rates of the tubes whose stats were fetched since
+// the previous scrape. A cumulative stat lower than the previous scrape
+// means it was reset (beanstalkd restarted, or the tube was recreated),
+// so the whole of the new value is counted.
+func (t *throughputTracker) observe(tubeStats map[string]cachedTubeStats) {
+	for tube := range t.previous {
+		if _, ok := tubeStats[tube]; !ok {
+			delete(t.previous, tube)
+			t.deleteMetrics(tube)
+		}
+	}
+
+	for tube, cached := range tubeStats {
+		puts, putsErr := strconv.ParseFloat(cached.stats["total-jobs"], 64)
+		deletes, deletesErr := strconv.ParseFloat(cached.stats["cmd-delete"], 64)
+		ready, readyErr := strconv.ParseFloat(cached.stats["current-jobs-ready"], 64)
+		if putsErr != nil || deletesErr != nil || readyErr != nil {
+			continue
+		}
+
+		previous, seen := t.previous[tube]
+		if seen && !cached.fetchedAt.After(previous.fetchedAt) {
+			continue
+		}
+		t.previous[tube] = throughputSnapshot{puts: puts, deletes: deletes, fetchedAt: cached.fetchedAt}
+		if !seen {
+			continue
+		}
+
+		seconds := cached.fetchedAt.Sub(previous.fetchedAt).Seconds()
+		putRate := counterIncrease(previous.puts, puts) / seconds
+		deleteRate := counterIncrease(previous.deletes, deletes) / seconds
+		t.putRate.WithLabelValues(tube).Set(putRate)
+		t.deleteRate.WithLabelValues(tube).Set(deleteRate)
+		t.backlogGrowth.WithLabelValues(tube).Set(putRate - deleteRate)
+
+		// There's no estimate while nothing is being deleted.
+		switch {
+		case ready == 0:
+			t.drainTime.WithLabelValues(tube).Set(0)
+		case deleteRate > 0:
+			t.drainTime.WithLabelValues(tube).Set(ready / deleteRate)
+		default:
+			t.drainTime.DeleteLabelValues(tube)
+		}
+	}
+}
+
+// counterIncrease returns the increase of a counter between
+// two values, allowing for the counter being reset.
+func counterIncrease(previous, current float64) float64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+func (t *throughputTracker) deleteMetrics(tube string) {
+	t.putRate.DeleteLabelValues(tube)
+	t.deleteRate.DeleteLabelValues(tube)
+	t.backlogGrowth.DeleteLabelValues(tube)
+	t.drainTime.DeleteLabelValues(tube)
+}
+
+func (t *throughputTracker) describe(ch chan<- *prometheus.Desc) {
+	t.putRate.Describe(ch)
+	t.deleteRate.Describe(ch)
+	t.backlogGrowth.Describe(ch)
+	t.drainTime.Describe(ch)
+}
+
+func (t *throughputTracker) collect(ch chan<- prometheus.Metric) {
+	t.putRate.Collect(ch)
+	t.deleteRate.Collect(ch)
+	t.backlogGrowth.Collect(ch)
+	t.drainTime.Collect(ch)
+}
@@ -0,0 +1,75 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+func TestThroughputTracker(t *testing.T) {
+	tracker := newThroughputTracker()
+	start := time.Now()
+
+	tests := []struct {
+		num              string
+		seconds          int
+		puts             string
+		deletes          string
+		ready            string
+		expectedPuts     float64
+		expectedDeletes  float64
+		expectedGrowth   float64
+		expectedDrain    float64
+		expectedDrainSet bool
+	}{
+		// We expect no rates from the first scrape.
+		{num: "1) ", seconds: 0, puts: "100", deletes: "50", ready: "50"},
+		// We expect the rates between the two scrapes.
+		{num: "2) ", seconds: 10, puts: "200", deletes: "100", ready: "100", expectedPuts: 10, expectedDeletes: 5, expectedGrowth: 5, expectedDrain: 20, expectedDrainSet: true},
+		// We expect the stats cached from the previous scrape to keep the rates.
+		{num: "3) ", seconds: 10, puts: "200", deletes: "100", ready: "100", expectedPuts: 10, expectedDeletes: 5, expectedGrowth: 5, expectedDrain: 20, expectedDrainSet: true},
+		// We expect no drain estimate while nothing is deleted.
+		{num: "4) ", seconds: 20, puts: "300", deletes: "100", ready: "200", expectedPuts: 10, expectedDeletes: 0, expectedGrowth: 10},
+		// We expect the whole of a reset counter to be counted.
+		{num: "5) ", seconds: 30, puts: "50", deletes: "20", ready: "0", expectedPuts: 5, expectedDeletes: 2, expectedGrowth: 3, expectedDrain: 0, expectedDrainSet: true},
+	}
+	for _, tt := range tests {
+		tracker.observe(map[string]cachedTubeStats{
+			"default": {
+				stats: beanstalkd.TubeStats{
+					"total-jobs":         tt.puts,
+					"cmd-delete":         tt.deletes,
+					"current-jobs-ready": tt.ready,
+				},
+				fetchedAt: start.Add(time.Duration(tt.seconds) * time.Second),
+			},
+		})
+		if actual := readGauge(tracker.putRate.WithLabelValues("default")); tt.expectedPuts != actual {
+			t.Errorf(tt.num+"expected put rate %v, actual %v", tt.expectedPuts, actual)
+		}
+		if actual := readGauge(tracker.deleteRate.WithLabelValues("default")); tt.expectedDeletes != actual {
+			t.Errorf(tt.num+"expected delete rate %v, actual %v", tt.expectedDeletes, actual)
+		}
+		if actual := readGauge(tracker.backlogGrowth.WithLabelValues("default")); tt.expectedGrowth != actual {
+			t.Errorf(tt.num+"expected backlog growth %v, actual %v", tt.expectedGrowth, actual)
+		}
+		drainSet := len(collectAll(tracker.drainTime)) > 0
+		if tt.expectedDrainSet != drainSet {
+			t.Errorf(tt.num+"expected drain time %v, actual %v", tt.expectedDrainSet, drainSet)
+		} else if drainSet {
+			if actual := readGauge(tracker.drainTime.WithLabelValues("default")); tt.expectedDrain != actual {
+				t.Errorf(tt.num+"expected drain time %v, actual %v", tt.expectedDrain, actual)
+			}
+		}
+	}
+
+	// We expect the tubes that are no longer scraped to be forgotten.
+	tracker.observe(map[string]cachedTubeStats{})
+	if expected, actual := 0, len(tracker.previous); expected != actual {
+		t.Errorf("expected %v tubes, actual %v", expected, actual)
+	}
+	if expected, actual := 0, len(collectAll(tracker.putRate)); expected != actual {
+		t.Errorf("expected %v metrics, actual %v", expected, actual)
+	}
+}
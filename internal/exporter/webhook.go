@@ -0,0 +1,93 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// webhookQueueSize is the number of notifications waiting to be
+	// sent, beyond which notifications are dropped.
+	webhookQueueSize = 100
+	webhookTimeout   = 10 * time.Second
+)
+
+// WebhookNotifier POSTs the rule notifications as JSON to webhooks,
+// in the background, so that slow webhooks don't hold up scrapes.
+type WebhookNotifier struct {
+	urls   []string
+	client *http.Client
+	queue  chan RuleNotification
+	logger *slog.Logger
+}
+
+// NewWebhookNotifier returns a notifier for the webhooks, which sends
+// the notifications once it's running.
+func NewWebhookNotifier(urls []string, logger *slog.Logger) *WebhookNotifier {
+	return &WebhookNotifier{
+		urls:   urls,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan RuleNotification, webhookQueueSize),
+		logger: logger,
+	}
+}
+
+// Notify queues the notification to be sent, or drops it when
+// the queue is full.
+func (w *WebhookNotifier) Notify(notification RuleNotification) {
+	select {
+	case w.queue <- notification:
+	default:
+		w.logger.Error("dropped rule notification, too many waiting to be sent", "rule", notification.Rule, "status", notification.Status)
+	}
+}
+
+// Run sends the queued notifications, until the context is done.
+func (w *WebhookNotifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-w.queue:
+			w.send(ctx, notification)
+		}
+	}
+}
+
+// send POSTs the notification to each of the webhooks.
+func (w *WebhookNotifier) send(ctx context.Context, notification RuleNotification) {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		w.logger.Error("error encoding rule notification", "rule", notification.Rule, "err", err)
+		return
+	}
+	for _, url := range w.urls {
+		if err := postJSON(ctx, w.client, url, body); err != nil {
+			w.logger.Error("error sending rule notification", "rule", notification.Rule, "url", url, "err", err)
+		}
+	}
+}
+
+// postJSON POSTs the JSON body to the URL, returning an error
+// unless the response is successful.
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan RuleNotification, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification RuleNotification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			t.Errorf("expected nil error, actual %v", err)
+		}
+		received <- notification
+	}))
+	defer webhook.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	// We expect a failing webhook not to stop the other webhooks being notified.
+	notifier := NewWebhookNotifier([]string{failing.URL, webhook.URL}, mockLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	expected := RuleNotification{
+		Rule:      "backlog",
+		Status:    RuleFiring,
+		Tube:      "default",
+		Stat:      "current-jobs-ready",
+		Value:     150,
+		Threshold: 100,
+		Since:     at.Add(-time.Minute),
+		At:        at,
+	}
+	notifier.Notify(expected)
+
+	select {
+	case actual := <-received:
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected %v, actual %v", expected, actual)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a notification")
+	}
+}
+
+func TestWebhookNotifierQueueFull(t *testing.T) {
+	notifier := NewWebhookNotifier([]string{"http://localhost:0"}, mockLogger())
+
+	// We expect the notifications beyond the queue to be dropped, without blocking.
+	for i := 0; i < webhookQueueSize+10; i++ {
+		notifier.Notify(RuleNotification{Rule: "backlog", Status: RuleFiring})
+	}
+	if expected, actual := webhookQueueSize, len(notifier.queue); expected != actual {
+		t.Errorf("expected %v queued, actual %v", expected, actual)
+	}
+}
@@ -0,0 +1,91 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
+)
+
+const defaultBuriedJobsLimit = 100
+
+// buriedJobsHandler lists the buried jobs in beanstalkd, grouped by tube,
+// so that they can be triaged from a browser. It has its own connection
+// to beanstalkd, which is only used by one request at a time.
+type buriedJobsHandler struct {
+	mutex        sync.Mutex
+	server       *beanstalkd.Server
+	maxScan      uint64
+	maxBodyBytes int
+	logger       *slog.Logger
+}
+
+type buriedJobsResponse struct {
+	Scanned uint64                 `json:"scanned"`
+	Tubes   map[string][]buriedJob `json:"tubes"`
+}
+
+type buriedJob struct {
+	ID        uint64 `json:"id"`
+	Age       int64  `json:"age"`
+	Priority  int64  `json:"priority"`
+	Releases  int64  `json:"releases"`
+	Kicks     int64  `json:"kicks"`
+	Timeouts  int64  `json:"timeouts"`
+	Body      string `json:"body,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+func (h *buriedJobsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	limit := defaultBuriedJobsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a number > 0", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	h.mutex.Lock()
+	jobs, scanned, err := h.server.FetchBuriedJobs(beanstalkd.BuriedJobsQuery{
+		Tube:         r.URL.Query().Get("tube"),
+		Limit:        limit,
+		MaxScan:      h.maxScan,
+		MaxBodyBytes: h.maxBodyBytes,
+	})
+	h.mutex.Unlock()
+	if err != nil {
+		h.logger.Error("error fetching buried jobs", "err", err)
+		http.Error(w, "error fetching buried jobs", http.StatusBadGateway)
+		return
+	}
+
+	response := buriedJobsResponse{
+		Scanned: scanned,
+		Tubes:   make(map[string][]buriedJob),
+	}
+	for _, job := range jobs {
+		response.Tubes[job.Tube] = append(response.Tubes[job.Tube], buriedJob{
+			ID:        job.ID,
+			Age:       jobStat(job.Stats, "age"),
+			Priority:  jobStat(job.Stats, "pri"),
+			Releases:  jobStat(job.Stats, "releases"),
+			Kicks:     jobStat(job.Stats, "kicks"),
+			Timeouts:  jobStat(job.Stats, "timeouts"),
+			Body:      string(job.Body),
+			Truncated: job.Truncated,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func jobStat(stats beanstalkd.JobStats, stat string) int64 {
+	v, _ := strconv.ParseInt(stats[stat], 10, 64)
+	return v
+}
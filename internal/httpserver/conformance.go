@@ -0,0 +1,47 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/exporter"
+)
+
+// conformanceHandler summarises the tube checks of the most recent
+// scrape as JSON. The status is 503 when any tube isn't conforming,
+// so that the endpoint can also be used as a health check.
+type conformanceHandler struct {
+	collector *exporter.BeanstalkdCollector
+}
+
+type conformanceResponse struct {
+	Conforming bool                          `json:"conforming"`
+	Tubes      map[string][]conformanceCheck `json:"tubes"`
+}
+
+type conformanceCheck struct {
+	Check      string `json:"check"`
+	Limit      *int64 `json:"limit,omitempty"`
+	Conforming bool   `json:"conforming"`
+}
+
+func (h *conformanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	response := conformanceResponse{
+		Conforming: true,
+		Tubes:      make(map[string][]conformanceCheck),
+	}
+	for _, result := range h.collector.Conformance() {
+		response.Tubes[result.Tube] = append(response.Tubes[result.Tube], conformanceCheck{
+			Check:      result.Check,
+			Limit:      result.Limit,
+			Conforming: result.Conforming,
+		})
+		response.Conforming = response.Conforming && result.Conforming
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !response.Conforming {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,68 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/davidtannock/beanstalkd_exporter/v2/internal/exporter"
+)
+
+// maintenanceHandler lists the maintenance windows in progress, and
+// starts (POST) and ends (DELETE) maintenance of the tubes matching
+// the "tubes" parameter, like during a deploy. There's no
+// authentication, so starting and ending maintenance is only allowed
+// when the handler is writable.
+type maintenanceHandler struct {
+	maintenance *exporter.Maintenance
+	writable    bool
+}
+
+type maintenanceWindow struct {
+	Name   string    `json:"name,omitempty"`
+	Tubes  string    `json:"tubes"`
+	EndsAt time.Time `json:"ends_at"`
+}
+
+func (h *maintenanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !h.writable {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tubes := r.URL.Query().Get("tubes")
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		duration, err := time.ParseDuration(r.URL.Query().Get("duration"))
+		if err != nil {
+			http.Error(w, "duration must be a duration, like 30m", http.StatusBadRequest)
+			return
+		}
+		if err := h.maintenance.Start(tubes, duration); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		if !h.maintenance.End(tubes) {
+			http.Error(w, "no maintenance started for the tubes", http.StatusNotFound)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	windows := []maintenanceWindow{}
+	for _, active := range h.maintenance.Active() {
+		windows = append(windows, maintenanceWindow{
+			Name:   active.Name,
+			Tubes:  active.Tubes,
+			EndsAt: active.EndsAt,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(windows)
+}
@@ -1,9 +1,12 @@
 package httpserver
 
 import (
+	"context"
+	"fmt"
 	"html"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/davidtannock/beanstalkd_exporter/v2/internal/beanstalkd"
 	"github.com/davidtannock/beanstalkd_exporter/v2/internal/exporter"
@@ -12,51 +15,140 @@ import (
 )
 
 var (
-	metricsPath string
+	metricsPath     string
+	buriedJobsPath  string
+	conformancePath string
+	maintenancePath string
 )
 
 // Opts contains the options for configuring the http server.
 type Opts struct {
-	ListenAddress string
-	MetricsPath   string
-
-	BeanstalkdAddress         string
-	BeanstalkdDialTimeout     uint
-	BeanstalkdKeepAlivePeriod uint
-	BeanstalkdSystemMetrics   []string
-	BeanstalkdAllTubes        bool
-	BeanstalkdTubes           []string
-	BeanstalkdTubeMetrics     []string
+	ListenAddress     string
+	MetricsPath       string
+	BuriedJobsPath    string
+	ConformancePath   string
+	MaintenancePath   string
+	MaintenanceWrites bool
+
+	BeanstalkdAddresses               []string
+	BeanstalkdDialTimeout             uint
+	BeanstalkdKeepAlivePeriod         uint
+	BeanstalkdRetries                 uint
+	BeanstalkdBreakerThreshold        uint
+	BeanstalkdBreakerCooldown         uint
+	BeanstalkdSystemMetrics           []string
+	BeanstalkdAllTubes                bool
+	BeanstalkdTubes                   []string
+	BeanstalkdTubeMetrics             []string
+	BeanstalkdHeadJobTubes            []string
+	BeanstalkdBodySizeTubes           []string
+	BeanstalkdJobLabelTubes           []string
+	BeanstalkdJobLabelField           string
+	BeanstalkdJobLabelMaxValues       uint
+	BeanstalkdTubesRefreshInterval    uint
+	BeanstalkdTubesPerScrape          uint
+	BeanstalkdTubesScrapeBudget       uint
+	BeanstalkdMaxTrackedTubes         uint
+	BeanstalkdPollInterval            uint
+	BeanstalkdMaxStaleness            uint
+	BeanstalkdScrapeReuseWindow       uint
+	BeanstalkdMinScrapeInterval       uint
+	BeanstalkdMaxCommandsPerSecond    uint
+	BeanstalkdFailurePolicy           string
+	BeanstalkdStaleGracePeriod        uint
+	BeanstalkdStitchCounters          bool
+	BeanstalkdBuriedJobsMaxScan       uint
+	BeanstalkdBuriedJobsBodyBytes     uint
+	BeanstalkdCensusWindow            uint
+	BeanstalkdCensusInterval          uint
+	BeanstalkdCensusCommandsPerSecond uint
+	BeanstalkdStalledScrapes          uint
+	BeanstalkdForecastThreshold       uint
+	BeanstalkdForecastWindow          uint
+	BeanstalkdTubeChecks              []string
+	BeanstalkdRulesFile               string
+	BeanstalkdRuleWebhooks            []string
+	BeanstalkdAlertmanagerURLs        []string
+	BeanstalkdAlertmanagerResend      uint
+	BeanstalkdMaintenanceFile         string
+	BeanstalkdCanaryTube              string
+	BeanstalkdCanaryTimeout           uint
 }
 
 // ListenAndServe initialises a http server and starts listening
 // for http requests.
 func ListenAndServe(opts Opts, logger *slog.Logger) error {
 	metricsPath = opts.MetricsPath
+	buriedJobsPath = opts.BuriedJobsPath
+	conformancePath = opts.ConformancePath
+	maintenancePath = opts.MaintenancePath
 
-	// Fetching all tubes overrides specific tubes.
-	tubes := opts.BeanstalkdTubes
-	if opts.BeanstalkdAllTubes {
-		tubes = nil
-	}
-
-	beanstalkdServer, err := beanstalkd.NewServer(
-		opts.BeanstalkdAddress,
-		opts.BeanstalkdDialTimeout,
-		opts.BeanstalkdKeepAlivePeriod,
-	)
+	beanstalkdServer, err := newBeanstalkdServer(opts)
 	if err != nil {
 		return err
 	}
 
+	// Threshold rules (if any) notify the webhooks, and push alerts to
+	// Alertmanager, in the background.
+	var rules []exporter.Rule
+	var ruleNotifiers []exporter.RuleNotifier
+	if opts.BeanstalkdRulesFile != "" {
+		rules, err = exporter.LoadRules(opts.BeanstalkdRulesFile)
+		if err != nil {
+			return err
+		}
+	}
+	if len(opts.BeanstalkdRuleWebhooks) > 0 {
+		webhooks := exporter.NewWebhookNotifier(opts.BeanstalkdRuleWebhooks, logger)
+		ruleNotifiers = append(ruleNotifiers, webhooks)
+		go webhooks.Run(context.Background())
+	}
+	if len(opts.BeanstalkdAlertmanagerURLs) > 0 {
+		alertmanager := exporter.NewAlertmanagerNotifier(
+			opts.BeanstalkdAlertmanagerURLs,
+			opts.BeanstalkdAddresses[0],
+			time.Duration(opts.BeanstalkdAlertmanagerResend)*time.Second,
+			logger,
+		)
+		ruleNotifiers = append(ruleNotifiers, alertmanager)
+		go alertmanager.Run(context.Background())
+	}
+
+	// Maintenance windows are scheduled, or started on demand.
+	var maintenance *exporter.Maintenance
+	if opts.BeanstalkdMaintenanceFile != "" || opts.MaintenancePath != "" {
+		var windows []exporter.MaintenanceWindow
+		if opts.BeanstalkdMaintenanceFile != "" {
+			windows, err = exporter.LoadMaintenanceWindows(opts.BeanstalkdMaintenanceFile)
+			if err != nil {
+				return err
+			}
+		}
+		maintenance, err = exporter.NewMaintenance(windows)
+		if err != nil {
+			return err
+		}
+	}
+
+	collectorOpts := opts.CollectorOpts()
+	collectorOpts.Rules = rules
+	collectorOpts.RuleNotifiers = ruleNotifiers
+	collectorOpts.Maintenance = maintenance
+
+	// The canary (if configured) has its own connection to beanstalkd,
+	// as it's probed in the background. Its commands aren't observed,
+	// as waiting for the canary job would skew the command latency.
+	if opts.BeanstalkdCanaryTube != "" {
+		canaryServer, err := newBeanstalkdServer(opts)
+		if err != nil {
+			return err
+		}
+		canaryServer.ShareMaxCommandsPerSecond(beanstalkdServer)
+		collectorOpts.CanaryServer = canaryServer
+	}
 	collector, err := exporter.NewBeanstalkdCollector(
 		beanstalkdServer,
-		exporter.CollectorOpts{
-			SystemMetrics: opts.BeanstalkdSystemMetrics,
-			AllTubes:      opts.BeanstalkdAllTubes,
-			Tubes:         tubes,
-			TubeMetrics:   opts.BeanstalkdTubeMetrics,
-		},
+		collectorOpts,
 		logger,
 	)
 	if err != nil {
@@ -65,22 +157,149 @@ func ListenAndServe(opts Opts, logger *slog.Logger) error {
 
 	prometheus.MustRegister(collector)
 
+	// Poll beanstalkd in the background (if configured).
+	go collector.Run(context.Background())
+
+	// Take a census of the most recent jobs in the background (if
+	// configured), on its own rate limited connection to beanstalkd.
+	if opts.BeanstalkdCensusWindow > 0 {
+		censusServer, err := newBeanstalkdServer(opts)
+		if err != nil {
+			return err
+		}
+		censusServer.SetMaxCommandsPerSecond(opts.BeanstalkdCensusCommandsPerSecond)
+		censusServer.SetCommandObserver(collector.ObserveCommand)
+		census := beanstalkd.NewCensus(
+			censusServer,
+			uint64(opts.BeanstalkdCensusWindow),
+			time.Duration(opts.BeanstalkdCensusInterval)*time.Second,
+		)
+		prometheus.MustRegister(exporter.NewCensusCollector(census))
+		go census.Run(context.Background())
+	}
+
 	http.HandleFunc("/", index)
 	http.Handle(opts.MetricsPath, promhttp.Handler())
 
+	// Buried jobs are listed on their own connection to beanstalkd
+	// (if enabled), so they don't get in the way of scrapes.
+	if opts.BuriedJobsPath != "" {
+		buriedJobsServer, err := newBeanstalkdServer(opts)
+		if err != nil {
+			return err
+		}
+		buriedJobsServer.ShareMaxCommandsPerSecond(beanstalkdServer)
+		buriedJobsServer.SetCommandObserver(collector.ObserveCommand)
+		http.Handle(opts.BuriedJobsPath, &buriedJobsHandler{
+			server:       buriedJobsServer,
+			maxScan:      uint64(opts.BeanstalkdBuriedJobsMaxScan),
+			maxBodyBytes: int(opts.BeanstalkdBuriedJobsBodyBytes),
+			logger:       logger,
+		})
+	}
+
+	// The tube checks of the most recent scrape are summarised (if enabled).
+	if opts.ConformancePath != "" {
+		http.Handle(opts.ConformancePath, &conformanceHandler{collector: collector})
+	}
+
+	// Maintenance windows are listed, started and ended (if enabled).
+	if opts.MaintenancePath != "" {
+		http.Handle(opts.MaintenancePath, &maintenanceHandler{
+			maintenance: maintenance,
+			writable:    opts.MaintenanceWrites,
+		})
+	}
+
 	logger.Info("started listening", "address", opts.ListenAddress)
 
 	return http.ListenAndServe(opts.ListenAddress, nil)
 }
 
+// CollectorOpts returns the options of the beanstalkd collector. The
+// rules, their notifiers, the maintenance and the canary's server are
+// left to the caller.
+func (opts Opts) CollectorOpts() exporter.CollectorOpts {
+	// Fetching all tubes overrides specific tubes.
+	tubes := opts.BeanstalkdTubes
+	if opts.BeanstalkdAllTubes {
+		tubes = nil
+	}
+
+	return exporter.CollectorOpts{
+		SystemMetrics:        opts.BeanstalkdSystemMetrics,
+		AllTubes:             opts.BeanstalkdAllTubes,
+		Tubes:                tubes,
+		TubeMetrics:          opts.BeanstalkdTubeMetrics,
+		HeadJobTubes:         opts.BeanstalkdHeadJobTubes,
+		BodySizeTubes:        opts.BeanstalkdBodySizeTubes,
+		JobLabelTubes:        opts.BeanstalkdJobLabelTubes,
+		JobLabelField:        opts.BeanstalkdJobLabelField,
+		JobLabelMaxValues:    int(opts.BeanstalkdJobLabelMaxValues),
+		StalledScrapes:       int(opts.BeanstalkdStalledScrapes),
+		ForecastThreshold:    int(opts.BeanstalkdForecastThreshold),
+		ForecastWindow:       time.Duration(opts.BeanstalkdForecastWindow) * time.Second,
+		TubeChecks:           opts.BeanstalkdTubeChecks,
+		CanaryTube:           opts.BeanstalkdCanaryTube,
+		CanaryTimeout:        time.Duration(opts.BeanstalkdCanaryTimeout) * time.Second,
+		MaxTrackedTubes:      int(opts.BeanstalkdMaxTrackedTubes),
+		TubesRefreshInterval: time.Duration(opts.BeanstalkdTubesRefreshInterval) * time.Second,
+		TubesPerScrape:       int(opts.BeanstalkdTubesPerScrape),
+		TubesScrapeBudget:    time.Duration(opts.BeanstalkdTubesScrapeBudget) * time.Millisecond,
+		PollInterval:         time.Duration(opts.BeanstalkdPollInterval) * time.Second,
+		MaxStaleness:         time.Duration(opts.BeanstalkdMaxStaleness) * time.Second,
+		ScrapeReuseWindow:    time.Duration(opts.BeanstalkdScrapeReuseWindow) * time.Millisecond,
+		MinScrapeInterval:    time.Duration(opts.BeanstalkdMinScrapeInterval) * time.Second,
+		FailurePolicy:        opts.BeanstalkdFailurePolicy,
+		StaleGracePeriod:     time.Duration(opts.BeanstalkdStaleGracePeriod) * time.Second,
+		StitchCounters:       opts.BeanstalkdStitchCounters,
+	}
+}
+
+// newBeanstalkdServer returns a beanstalkd.Server configured from the options.
+func newBeanstalkdServer(opts Opts) (*beanstalkd.Server, error) {
+	if len(opts.BeanstalkdAddresses) == 0 {
+		return nil, fmt.Errorf("no beanstalkd address")
+	}
+	server, err := beanstalkd.NewServer(
+		opts.BeanstalkdAddresses[0],
+		opts.BeanstalkdDialTimeout,
+		opts.BeanstalkdKeepAlivePeriod,
+	)
+	if err != nil {
+		return nil, err
+	}
+	server.SetAddresses(opts.BeanstalkdAddresses)
+	server.SetMaxCommandsPerSecond(opts.BeanstalkdMaxCommandsPerSecond)
+	server.SetRetries(opts.BeanstalkdRetries)
+	server.SetCircuitBreaker(
+		opts.BeanstalkdBreakerThreshold,
+		time.Duration(opts.BeanstalkdBreakerCooldown)*time.Second,
+	)
+	return server, nil
+}
+
 func index(w http.ResponseWriter, r *http.Request) {
+	links := `<p><a href="` + html.EscapeString(metricsPath) + `">Metrics</a></p>`
+	if buriedJobsPath != "" {
+		links += `
+		<p><a href="` + html.EscapeString(buriedJobsPath) + `">Buried Jobs</a></p>`
+	}
+	if conformancePath != "" {
+		links += `
+		<p><a href="` + html.EscapeString(conformancePath) + `">Tube Conformance</a></p>`
+	}
+	if maintenancePath != "" {
+		links += `
+		<p><a href="` + html.EscapeString(maintenancePath) + `">Maintenance</a></p>`
+	}
 	_, _ = w.Write([]byte(`<html>
 	<head>
 		<title>Beanstalkd Exporter</title>
 	</head>
 	<body>
 		<h1>Beanstalkd Exporter</h1>
-		<p><a href="` + html.EscapeString(metricsPath) + `">Metrics</a></p>
+		` + links + `
 	</body>
 </html>`))
 }